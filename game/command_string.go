@@ -4,9 +4,9 @@ package game
 
 import "strconv"
 
-const _Command_name = "NoneVersionCleanCompileStatic"
+const _Command_name = "NoneVersionCleanCompileStaticInitCompletion"
 
-var _Command_index = [...]uint8{0, 4, 14, 16, 29}
+var _Command_index = [...]uint8{0, 4, 11, 16, 29, 33, 43}
 
 func (i Command) String() string {
 	if i < 0 || i >= Command(len(_Command_index)-1) {
@@ -6,6 +6,54 @@ import (
 	"testing"
 )
 
+func TestGameImportsListNamespace(t *testing.T) {
+	tests := []struct {
+		namespace string
+		code      int
+		stdout    string
+		stderr    string
+	}{
+		{namespace: "zz", stdout: `
+Targets:
+zz
+  zz:buildSubdir2    Builds stuff.
+
+zz:ns - NS is a namespace.
+  zz:ns:deploy2*    deploys stuff.
+
+* default target
+`[1:]},
+		{namespace: "NS:", stdout: `
+Targets:
+ns - NS is a namespace.
+  ns:deploy    deploys stuff.
+`[1:]},
+		{namespace: "z", code: 2, stderr: "No targets in namespace z\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.namespace, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			inv := Invocation{
+				Dir:    "./testdata/gameimport",
+				Stdout: stdout,
+				Stderr: stderr,
+				List:   true,
+				Args:   []string{tt.namespace},
+			}
+			if code := Invoke(inv); code != tt.code {
+				t.Fatalf("expected to exit with code %d, but got %v, stderr:\n%s", tt.code, code, stderr)
+			}
+			if actual := stdout.String(); actual != tt.stdout {
+				t.Errorf("expected:\n%v\n\ngot:\n%v", tt.stdout, actual)
+			}
+			if actual := stderr.String(); actual != tt.stderr {
+				t.Errorf("expected stderr %q, but got %q", tt.stderr, actual)
+			}
+		})
+	}
+}
+
 func TestGameImportsList(t *testing.T) {
 	stdout := &bytes.Buffer{}
 	stderr := &bytes.Buffer{}
@@ -23,11 +71,17 @@ func TestGameImportsList(t *testing.T) {
 	actual := stdout.String()
 	expected := `
 Targets:
-  buildSubdir        Builds stuff.
-  ns:deploy          deploys stuff.
-  root               
+  buildSubdir    Builds stuff.
+  root           
+
+ns - NS is a namespace.
+  ns:deploy    deploys stuff.
+
+zz
   zz:buildSubdir2    Builds stuff.
-  zz:ns:deploy2*     deploys stuff.
+
+zz:ns - NS is a namespace.
+  zz:ns:deploy2*    deploys stuff.
 
 * default target
 `[1:]
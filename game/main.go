@@ -6,6 +6,7 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"go/build"
 	"io"
 	"io/ioutil"
 	"log"
@@ -15,6 +16,7 @@ import (
 	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template"
@@ -23,6 +25,7 @@ import (
 	"github.com/ridge/game/internal"
 	"github.com/ridge/game/mg"
 	"github.com/ridge/game/parse"
+	"github.com/ridge/game/toplevel"
 )
 
 // magicRebuildKey is used when hashing the output binary to ensure that we get
@@ -58,6 +61,8 @@ var mainfileTemplate = template.Must(template.New("").Funcs(map[string]interface
 	},
 }).Parse(gameMainfileTplString))
 
+var initOutput = template.Must(template.New("").Parse(gamefileTplString))
+
 const mainfile = "game_output_file.go"
 const initFile = "gamefile.go"
 
@@ -81,6 +86,8 @@ const (
 	Version               // report the current version of game
 	Clean                 // clean out old compiled game binaries from the cache
 	CompileStatic         // compile a static binary of the current directory
+	Init                  // create a starting gamefile
+	Completion            // print a shell completion script
 )
 
 // Main is the entrypoint for running game.  It exists external to game's main
@@ -100,6 +107,9 @@ type Invocation struct {
 	Help       bool          // tells the gamefile to print out help for a specific target
 	Keep       bool          // tells game to keep the generated main file after compiling
 	Timeout    time.Duration // tells game to set a timeout to running the targets
+	Jobs       int           // tells game to limit the number of tasks running simultaneously
+	FailFast   bool          // tells game to cancel remaining tasks as soon as one of them fails
+	DryRun     bool          // tells the gamefile to print the graph of tasks instead of running them
 	CompileOut string        // tells game to compile a static binary to this path, but not execute
 	GOOS       string        // sets the GOOS when producing a binary with -compileout
 	GOARCH     string        // sets the GOARCH when producing a binary with -compileout
@@ -111,6 +121,22 @@ type Invocation struct {
 	CacheDir   string        // the directory where we should store compiled binaries
 	HashFast   bool          // don't rely on GOCACHE, just hash the gamefiles
 	Trace      string        // tells game to trace tasks write results to file
+	Events     string        // tells game to write task events as JSON to file or fd:N
+	JUnit      string        // tells game to save results of tasks to file in JUnit XML format
+	Watch      bool          // tells game to run the targets again when files they depend on change
+	Summary    bool          // tells the gamefile to print the critical path and the slowest tasks after running
+	Grouped    bool          // tells the gamefile to print the output of each task as a block once it finishes
+	ListAll    bool          // tells the gamefile to list hidden targets too
+	ListFormat string        // tells the gamefile to list targets in this format: text or json
+	History    string        // tells the gamefile to print timings of the recent runs of this task
+	Completion string        // the shell to print a completion script for
+	Prefix     bool          // tells the gamefile to run targets given by unambiguous prefixes of their names
+	// tells the gamefile to print names of targets for shell completion
+	CompleteTargets bool
+
+	gamefiles       []string                  // absolute paths of gamefiles, watched in watch mode
+	ran             bool                      // whether the compiled binary has been run
+	completionFlags []toplevel.CompletionFlag // flags completed by completion scripts
 }
 
 // ParseAndRun parses the command line, and then compiles and runs the game
@@ -144,6 +170,21 @@ func ParseAndRun(stdout, stderr io.Writer, stdin io.Reader, args []string) int {
 		}
 		out.Println(inv.CacheDir, "cleaned")
 		return 0
+	case Completion:
+		script, err := toplevel.CompletionScript(inv.Completion, "game", inv.completionFlags)
+		if err != nil {
+			errlog.Println("Error:", err)
+			return 2
+		}
+		out.Print(script)
+		return 0
+	case Init:
+		if err := generateInit(inv); err != nil {
+			errlog.Println("Error:", err)
+			return 1
+		}
+		out.Println(initFile, "created")
+		return 0
 	case CompileStatic:
 		return Invoke(inv)
 	case None:
@@ -167,20 +208,37 @@ func Parse(stderr, stdout io.Writer, args []string) (inv Invocation, cmd Command
 	fs.BoolVar(&inv.Verbose, "v", mg.Verbose(), "show verbose output when running game targets")
 	fs.BoolVar(&inv.Help, "h", false, "show this help")
 	fs.DurationVar(&inv.Timeout, "t", 0, "timeout in duration parsable format (e.g. 5m30s)")
+	fs.IntVar(&inv.Jobs, "j", 0, "limit the number of tasks running simultaneously (0 means no limit)")
+	fs.BoolVar(&inv.FailFast, "fail-fast", false, "cancel remaining tasks as soon as one of them fails")
 	fs.BoolVar(&inv.Keep, "keep", false, "keep intermediate game files around after running")
 	fs.StringVar(&inv.Dir, "d", ".", "run gamefiles in the given directory")
 	fs.StringVar(&inv.GoCmd, "gocmd", mg.GoCmd(), "use the given go binary to compile the output")
 	fs.StringVar(&inv.GOOS, "goos", "", "set GOOS for binary produced with -compile")
 	fs.StringVar(&inv.GOARCH, "goarch", "", "set GOARCH for binary produced with -compile")
 	fs.StringVar(&inv.Trace, "trace", "", "trace task execution and save it to the given file in Chrome trace_event format")
+	fs.StringVar(&inv.Events, "events", "", "write task events as newline-delimited JSON to the given file or fd:N")
+	fs.StringVar(&inv.JUnit, "junit", "", "save results of tasks to the given file in JUnit XML format")
+	fs.BoolVar(&inv.Watch, "w", false, "run the targets again when gamefiles or files they depend on change")
+	fs.BoolVar(&inv.Grouped, "grouped", false, "print the output of each task as a block once it finishes")
+	fs.BoolVar(&inv.Summary, "summary", false, "print the critical path and the slowest tasks after running the targets")
+	fs.BoolVar(&inv.Prefix, "prefix", false, "run targets given by unambiguous prefixes of their names")
 
 	// commands below
 
 	fs.BoolVar(&inv.List, "l", false, "list game targets in this directory")
+	fs.BoolVar(&inv.ListAll, "all", false, "list hidden targets too")
+	fs.StringVar(&inv.ListFormat, "format", "", "format of the list of targets: text or json")
+	fs.StringVar(&inv.History, "history", "", "print timings of the recent runs of the given task")
+	fs.BoolVar(&inv.DryRun, "n", false, "print the graph of tasks instead of running them")
+	fs.BoolVar(&inv.DryRun, "dry-run", false, "print the graph of tasks instead of running them")
 	var showVersion bool
 	fs.BoolVar(&showVersion, "version", false, "show version info for the game binary")
 	var clean bool
 	fs.BoolVar(&clean, "clean", false, "clean out old generated binaries from CACHE_DIR")
+	var initGamefile bool
+	fs.BoolVar(&initGamefile, "init", false, "create a starting template if no game files exist")
+	fs.StringVar(&inv.Completion, "completion", "", "print a shell completion script for bash, zsh or fish")
+	fs.BoolVar(&inv.CompleteTargets, "complete-targets", false, "")
 	var compileOutPath string
 	fs.StringVar(&compileOutPath, "compile", "", "output a static binary to the given path")
 
@@ -194,25 +252,47 @@ Commands:
   -clean    clean out old generated binaries from CACHE_DIR
   -compile <string>
             output a static binary to the given path
+  -completion <string>
+            print a shell completion script for bash, zsh or fish
   -init     create a starting template if no game files exist
-  -l        list game targets in this directory
+  -l [namespace]
+            list game targets in this directory, or only those in the given namespace
+  -l -all   list game targets in this directory, including hidden ones
+  -l -format <string>
+            list game targets in the given format: text (default) or json
   -h        show this help
+  -history <string>
+            print timings of the recent runs of the given task
+  -n, -dry-run
+            print the graph of tasks for the targets instead of running them
   -version  show version info for the game binary
 
 Options:
   -d <string>
             run gamefiles in the given directory (default ".")
   -debug    turn on debug messages
+  -events <string>
+            write task events as newline-delimited JSON to the given file or fd:N
+  -fail-fast
+            cancel remaining tasks as soon as one of them fails
+  -grouped  print the output of each task as a block once it finishes
   -h        show description of a target
   -f        force recreation of compiled gamefile
+  -j <int>
+            limit the number of tasks running simultaneously (0 means no limit)
+  -junit <string>
+            save results of tasks to the given file in JUnit XML format
   -keep     keep intermediate game files around after running
   -gocmd <string>
 		    use the given go binary to compile the output (default: "go")
   -goos     sets the GOOS for the binary created by -compile (default: current OS)
   -goarch   sets the GOARCH for the binary created by -compile (default: current arch)
+  -prefix   run targets given by unambiguous prefixes of their names (e.g. dep:up for deploy:upload)
+  -summary  print the critical path and the slowest tasks after running the targets
   -t <string>
             timeout in duration parsable format (e.g. 5m30s)
   -v        show verbose output when running game targets
+  -w        run the targets again when gamefiles or files they depend on change
 `[1:])
 	}
 	err = fs.Parse(args)
@@ -236,6 +316,24 @@ Options:
 	case showVersion:
 		numCommands++
 		cmd = Version
+	case initGamefile:
+		numCommands++
+		cmd = Init
+	case inv.Completion != "":
+		numCommands++
+		cmd = Completion
+		inv.completionFlags = toplevel.CompletionFlags(&fs, map[string]string{
+			"compile":    "file",
+			"completion": "bash zsh fish",
+			"d":          "dir",
+			"events":     "file",
+			"format":     "text json",
+			"gocmd":      "file",
+			"goarch":     "386 amd64 arm arm64 mips mips64 mips64le mipsle ppc64 ppc64le riscv64 s390x wasm",
+			"goos":       "aix android darwin dragonfly freebsd illumos ios js linux netbsd openbsd plan9 solaris windows",
+			"junit":      "file",
+			"trace":      "file",
+		})
 	case clean:
 		numCommands++
 		cmd = Clean
@@ -260,6 +358,10 @@ Options:
 		return inv, cmd, errors.New("-h, -init, -clean, -compile and -version cannot be used simultaneously")
 	}
 
+	if inv.Jobs < 0 {
+		return inv, cmd, errors.New("-j must not be negative")
+	}
+
 	if cmd != CompileStatic && (inv.GOARCH != "" || inv.GOOS != "") {
 		return inv, cmd, errors.New("-goos and -goarch only apply when running with -compile")
 	}
@@ -278,6 +380,33 @@ Options:
 
 // Invoke runs Game with the given arguments.
 func Invoke(inv Invocation) int {
+	if !inv.Watch {
+		return invoke(&inv)
+	}
+	for {
+		inv.ran = false
+		code := invoke(&inv)
+		// The binary exits with this code once gamefiles change
+		if code == mg.WatchRebuildExitCode {
+			continue
+		}
+		if inv.ran || len(inv.gamefiles) == 0 {
+			return code
+		}
+
+		// The gamefiles are broken, e.g. fail to compile, so retry once they
+		// have been fixed
+		fmt.Fprintln(inv.Stdout, "Waiting for gamefiles to change...")
+		changed, err := toplevel.WaitForChange(inv.gamefiles)
+		if err != nil {
+			fmt.Fprintf(inv.Stderr, "Failed to watch gamefiles: %v\n", err)
+			return code
+		}
+		fmt.Fprintf(inv.Stdout, "%s changed, rebuilding\n", changed)
+	}
+}
+
+func invoke(inv *Invocation) int {
 	errlog := log.New(inv.Stderr, "", 0)
 	if inv.GoCmd == "" {
 		inv.GoCmd = "go"
@@ -302,6 +431,17 @@ func Invoke(inv Invocation) int {
 		return 1
 	}
 	debug.Printf("found gamefiles: %s", strings.Join(files, ", "))
+	if inv.Watch {
+		inv.gamefiles = nil
+		for _, file := range files {
+			abs, err := filepath.Abs(file)
+			if err != nil {
+				errlog.Println("Error:", err)
+				return 1
+			}
+			inv.gamefiles = append(inv.gamefiles, abs)
+		}
+	}
 	exePath := inv.CompileOut
 	if inv.CompileOut == "" {
 		exePath, err = ExeName(inv.GoCmd, inv.CacheDir, files)
@@ -338,7 +478,8 @@ func Invoke(inv Invocation) int {
 				debug.Println("ignoring existing executable")
 			} else {
 				debug.Println("Running existing exe")
-				return RunCompiled(inv, exePath, errlog)
+				inv.ran = true
+				return RunCompiled(*inv, exePath, errlog)
 			}
 		case os.IsNotExist(err):
 			debug.Println("no existing exe, creating new")
@@ -395,13 +536,15 @@ func Invoke(inv Invocation) int {
 		return 0
 	}
 
-	return RunCompiled(inv, exePath, errlog)
+	inv.ran = true
+	return RunCompiled(*inv, exePath, errlog)
 }
 
 type mainfileTemplateData struct {
 	Description    string
 	Funcs          []*parse.Function
 	DefaultFunc    parse.Function
+	Aliases        map[*parse.Function][]string
 	Imports        []*parse.Import
 	Vars           []*parse.Var
 	HasUsageConfig bool
@@ -595,6 +738,14 @@ func GenerateMainfile(binaryName, path string, info *parse.PrimaryPkgInfo, modul
 		data.DefaultFunc = *info.DefaultFunc
 	}
 
+	data.Aliases = map[*parse.Function][]string{}
+	for alias, f := range info.Aliases {
+		data.Aliases[f] = append(data.Aliases[f], alias)
+	}
+	for _, aliases := range data.Aliases {
+		sort.Strings(aliases)
+	}
+
 	debug.Println("writing new file at", path)
 	if err := mainfileTemplate.Execute(f, data); err != nil {
 		return fmt.Errorf("can't execute mainfile template: %v", err)
@@ -693,9 +844,18 @@ func RunCompiled(inv Invocation, exePath string, errlog *log.Logger) int {
 	if inv.List {
 		c.Env = append(c.Env, "GAMEFILE_LIST=1")
 	}
+	if inv.ListAll {
+		c.Env = append(c.Env, mg.ListAllEnv+"=1")
+	}
+	if inv.ListFormat != "" {
+		c.Env = append(c.Env, mg.ListFormatEnv+"="+inv.ListFormat)
+	}
 	if inv.Help {
 		c.Env = append(c.Env, "GAMEFILE_HELP=1")
 	}
+	if inv.History != "" {
+		c.Env = append(c.Env, mg.HistoryEnv+"="+inv.History)
+	}
 	if inv.Debug {
 		c.Env = append(c.Env, "GAMEFILE_DEBUG=1")
 	}
@@ -708,6 +868,45 @@ func RunCompiled(inv Invocation, exePath string, errlog *log.Logger) int {
 	if inv.Trace != "" {
 		c.Env = append(c.Env, "GAMEFILE_TRACE="+inv.Trace)
 	}
+	if inv.Jobs > 0 {
+		c.Env = append(c.Env, fmt.Sprintf("%s=%d", mg.JobsEnv, inv.Jobs))
+	}
+	if inv.FailFast {
+		c.Env = append(c.Env, mg.FailFastEnv+"=1")
+	}
+	if inv.DryRun {
+		c.Env = append(c.Env, mg.DryRunEnv+"=1")
+	}
+	if inv.Summary {
+		c.Env = append(c.Env, mg.SummaryEnv+"=1")
+	}
+	if inv.Grouped {
+		c.Env = append(c.Env, mg.GroupedOutputEnv+"=1")
+	}
+	if inv.JUnit != "" {
+		c.Env = append(c.Env, mg.JUnitEnv+"="+inv.JUnit)
+	}
+	if inv.CompleteTargets {
+		c.Env = append(c.Env, mg.CompleteTargetsEnv+"=1")
+	}
+	if inv.Prefix {
+		c.Env = append(c.Env, mg.PrefixEnv+"=1")
+	}
+	if inv.Watch {
+		c.Env = append(c.Env, mg.WatchEnv+"=1",
+			mg.WatchFilesEnv+"="+strings.Join(inv.gamefiles, string(os.PathListSeparator)))
+	}
+	if inv.Events != "" {
+		events := inv.Events
+		if fd := strings.TrimPrefix(events, "fd:"); fd != events {
+			// pass the descriptor to the compiled binary, where it becomes fd 3
+			if n, err := strconv.Atoi(fd); err == nil {
+				c.ExtraFiles = []*os.File{os.NewFile(uintptr(n), events)}
+				events = "fd:3"
+			}
+		}
+		c.Env = append(c.Env, mg.EventsEnv+"="+events)
+	}
 	debug.Print("running gamefile with game vars:\n", strings.Join(filter(c.Env, "GAMEFILE"), "\n"))
 	err := c.Run()
 	if !cmdRan(err) {
@@ -726,8 +925,111 @@ func filter(list []string, prefix string) []string {
 	return out
 }
 
-// removeContents removes all files but not any subdirectories in the given
-// directory.
+// goModFile returns the path to the go.mod file of the module containing dir,
+// or "" if dir is not inside a module.
+func goModFile(goCmd, dir string) (string, error) {
+	debug.Println("getting go.mod file of", dir)
+	cmd := exec.Command(goCmd, "env", "GOMOD")
+	cmd.Dir = dir
+	buf := &bytes.Buffer{}
+	cmd.Stderr = buf
+	b, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run %s env GOMOD: %v: %s", goCmd, err, buf.Bytes())
+	}
+	gomod := strings.TrimSpace(string(b))
+	if gomod == os.DevNull {
+		return "", nil
+	}
+	return gomod, nil
+}
+
+// generateInit creates a starting gamefile in the invocation directory, unless
+// there are gamefiles already.
+func generateInit(inv Invocation) error {
+	if inv.GoCmd == "" {
+		inv.GoCmd = "go"
+	}
+	if inv.Dir == "" {
+		inv.Dir = "."
+	}
+
+	gomod, err := goModFile(inv.GoCmd, inv.Dir)
+	if err != nil {
+		return err
+	}
+
+	var existing []string
+	if gomod != "" {
+		gamefiles, err := Gamefiles(inv.Dir, "", "", inv.GoCmd, inv.Stderr, inv.Debug)
+		if err != nil {
+			return fmt.Errorf("error determining list of gamefiles: %v", err)
+		}
+		existing = gamefiles.files
+	} else {
+		existing, err = taggedGamefiles(inv.Dir)
+		if err != nil {
+			return fmt.Errorf("error determining list of gamefiles: %v", err)
+		}
+	}
+	if len(existing) > 0 {
+		return fmt.Errorf("gamefiles already exist: %s", strings.Join(existing, ", "))
+	}
+
+	path := filepath.Join(inv.Dir, initFile)
+	debug.Println("generating default gamefile at", path)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("could not create gamefile: %v", err)
+	}
+	defer f.Close()
+
+	if err := initOutput.Execute(f, nil); err != nil {
+		return fmt.Errorf("can't execute gamefile template: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error closing gamefile: %v", err)
+	}
+
+	if gomod == "" {
+		fmt.Fprintf(inv.Stderr, "Warning: %s is not inside a Go module. Run \"go mod init <module>\" and \"go get github.com/ridge/game\" to be able to build it.\n", inv.Dir)
+	}
+	return nil
+}
+
+// taggedGamefiles returns the Go files in the directory that are only built
+// with the game build tag. Unlike Gamefiles, it works outside of Go modules.
+func taggedGamefiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	withTag := build.Default
+	withTag.BuildTags = []string{"game"}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		tagged, err := withTag.MatchFile(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		untagged, err := build.Default.MatchFile(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if tagged && !untagged {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	return files, nil
+}
+
+// removeContents removes all files in the given directory, along with the
+// results of cacheable tasks and timings of tasks, but not any other
+// subdirectories.
 func removeContents(dir string) error {
 	debug.Println("removing all files in", dir)
 	files, err := ioutil.ReadDir(dir)
@@ -739,6 +1041,11 @@ func removeContents(dir string) error {
 	}
 	for _, f := range files {
 		if f.IsDir() {
+			if f.Name() == mg.TasksCacheDir || f.Name() == mg.HistoryCacheDir {
+				if err := os.RemoveAll(filepath.Join(dir, f.Name())); err != nil {
+					return err
+				}
+			}
 			continue
 		}
 		err = os.Remove(filepath.Join(dir, f.Name()))
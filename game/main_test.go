@@ -5,6 +5,8 @@ import (
 	"debug/elf"
 	"debug/macho"
 	"debug/plan9obj"
+	"encoding/json"
+	"encoding/xml"
 	"flag"
 	"fmt"
 	"go/build"
@@ -12,6 +14,8 @@ import (
 	"go/token"
 	"io/ioutil"
 	"log"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -21,6 +25,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -807,6 +812,1659 @@ func TestTimeout(t *testing.T) {
 		t.Fatalf("expected %q, but got %q", expected, actual)
 	}
 }
+func TestJobs(t *testing.T) {
+	tests := []struct {
+		jobs     int
+		expected string
+	}{
+		{jobs: 1, expected: "peak 1\n"},
+		{jobs: 2, expected: "peak 2\n"},
+	}
+	for _, tt := range tests {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		inv := Invocation{
+			Dir:    "testdata/jobs",
+			Stdout: stdout,
+			Stderr: stderr,
+			Args:   []string{"fanout"},
+			Jobs:   tt.jobs,
+		}
+		code := Invoke(inv)
+		if code != 0 {
+			t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+		}
+		if actual := stdout.String(); !strings.Contains(actual, tt.expected) {
+			t.Fatalf("-j %d: expected %q, but got %q", tt.jobs, tt.expected, actual)
+		}
+	}
+}
+
+func TestPools(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "testdata/pools",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"queries"},
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	actual := stdout.String()
+	for _, expected := range []string{"peak 1\n", " WAITING ", " ACQUIRED "} {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("expected %q, but got %q", expected, actual)
+		}
+	}
+}
+
+func TestParseNegativeJobs(t *testing.T) {
+	_, _, err := Parse(ioutil.Discard, ioutil.Discard, []string{"-j", "-1"})
+	expected := "-j must not be negative"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("expected error %q, but got %v", expected, err)
+	}
+}
+
+func TestFailFast(t *testing.T) {
+	tests := []struct {
+		target   string
+		failFast bool
+	}{
+		{target: "build", failFast: true},
+		{target: "explicit", failFast: false},
+	}
+	for _, tt := range tests {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		inv := Invocation{
+			Dir:      "testdata/failfast",
+			Stdout:   stdout,
+			Stderr:   stderr,
+			Args:     []string{tt.target},
+			FailFast: tt.failFast,
+		}
+		start := time.Now()
+		code := Invoke(inv)
+		if code != 1 {
+			t.Fatalf("expected 1, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+		}
+		// Slow takes a minute unless cancelled, much longer than compiling
+		// the gamefile
+		if time.Since(start) > 30*time.Second {
+			t.Fatalf("%s: expected slow task to be cancelled", tt.target)
+		}
+		actual := stdout.String()
+		for _, expected := range []string{
+			"CANCELLED Slow",
+			"(1 subtask cancelled)\n",
+			"Broken failed: compile error\n",
+		} {
+			if !strings.Contains(actual, expected) {
+				t.Fatalf("%s: expected %q, but got %q", tt.target, expected, actual)
+			}
+		}
+		if strings.Contains(actual, "Slow failed") {
+			t.Fatalf("%s: expected cancelled task to be omitted from failures, but got %q", tt.target, actual)
+		}
+	}
+
+	// Tasks waiting for a job slot are cancelled instead of being run
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:      "testdata/failfast",
+		Stdout:   stdout,
+		Stderr:   stderr,
+		Args:     []string{"limited"},
+		FailFast: true,
+		Jobs:     1,
+	}
+	if code := Invoke(inv); code != 1 {
+		t.Fatalf("expected 1, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	actual := stdout.String()
+	failed := strings.Index(actual, "FAILED Broken")
+	if failed == -1 {
+		t.Fatalf("expected Broken to fail, but got %q", actual)
+	}
+	if after := actual[failed:]; strings.Contains(after, "SUCCEEDED Sleeper") {
+		t.Errorf("expected no tasks to run after Broken has failed, but got %q", actual)
+	}
+	if !strings.Contains(actual, "CANCELLED Sleeper") {
+		t.Errorf("expected tasks waiting for a job slot to be cancelled, but got %q", actual)
+	}
+
+	// Sequential subtasks remaining after a failure are reported cancelled
+	stdout = &bytes.Buffer{}
+	stderr = &bytes.Buffer{}
+	inv.Stdout = stdout
+	inv.Stderr = stderr
+	inv.Args = []string{"sequential"}
+	inv.Jobs = 0
+	if code := Invoke(inv); code != 1 {
+		t.Fatalf("expected 1, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	actual = stdout.String()
+	for _, expected := range []string{
+		"STARTED Sleeper5\n",
+		"CANCELLED Sleeper5 ",
+		"(1 subtask cancelled)\n",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("expected %q, but got %q", expected, actual)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "testdata/dryrun",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"build", "release"},
+		DryRun: true,
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	expected := `
+#0000 main.Link{}
+    #0002 compile server
+        #0004 Generate <dependencies unknown>
+    #0003 compile client
+        #0004 Generate <see above>
+#0001 Release <dependencies unknown>
+`[1:]
+	if actual := stdout.String(); actual != expected {
+		t.Fatalf("expected:\n%s\n\ngot:\n%s", expected, actual)
+	}
+
+	stdout.Reset()
+	inv.DryRun = false
+	inv.Args = []string{"release"}
+	code = Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	actual := stdout.String()
+	if !regexp.MustCompile(`(?s)generate\n.*compile (server|client)\n.*link\n.*release\n`).MatchString(actual) {
+		t.Fatalf("expected static dependencies to run before tasks, but got %q", actual)
+	}
+}
+
+func TestTaskTimeout(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "testdata/tasktimeout",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"update"},
+	}
+	code := Invoke(inv)
+	if code != 1 {
+		t.Fatalf("expected 1, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	actual := stdout.String()
+	for _, expected := range []string{
+		"#0001 CANCELLED Download",
+		"#0000 TIMEDOUT main.Fetch{}",
+		"#0000 main.Fetch{} timed out: Exceeded timeout of 50ms\n",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("expected %q, but got %q", expected, actual)
+		}
+	}
+	// Only the task with the timeout has failed, not its subtasks
+	if strings.Contains(actual, "FAILED") {
+		t.Fatalf("expected subtasks of the timed out task to be cancelled, but got %q", actual)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		target   string
+		code     int
+		expected []string
+	}{
+		{
+			target: "recovers",
+			code:   0,
+			expected: []string{
+				"#0001   | attempt 1\n#0001 E | --- Attempt 1 of 3 failed: flaky\n#0001 RETRYING flaky 2 flaky attempt=2\n",
+				"#0001   | attempt 3\n#0001 SUCCEEDED flaky 2 flaky",
+				"attempts=3\n",
+			},
+		},
+		{
+			target: "givesUp",
+			code:   1,
+			expected: []string{
+				"#0001 E | --- Attempt 2 of 3 failed: flaky\n",
+				"#0001   | attempt 3\n#0001 E | flaky\n#0001 FAILED flaky 5 flaky",
+			},
+		},
+		{
+			target: "fatal",
+			code:   1,
+			expected: []string{
+				"#0001   | attempt 1\n#0001 E | fatal\n#0001 FAILED flaky 5 fatal",
+			},
+		},
+	}
+	for _, tt := range tests {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		inv := Invocation{
+			Dir:    "testdata/retry",
+			Stdout: stdout,
+			Stderr: stderr,
+			Args:   []string{tt.target},
+		}
+		code := Invoke(inv)
+		if code != tt.code {
+			t.Fatalf("%s: expected %d, but got %v, stderr: %q, stdout: %q", tt.target, tt.code, code, stderr, stdout)
+		}
+		actual := stdout.String()
+		for _, expected := range tt.expected {
+			if !strings.Contains(actual, expected) {
+				t.Fatalf("%s: expected %q, but got %q", tt.target, expected, actual)
+			}
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	eventsFile := filepath.Join(dir, "events.json")
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "testdata/retry",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"recovers"},
+		Events: eventsFile,
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+
+	data, err := ioutil.ReadFile(eventsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var ev map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("invalid event %q: %v", line, err)
+		}
+		if ev["v"] != 1.0 {
+			t.Fatalf("expected schema version 1, but got %q", line)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, ev["time"].(string)); err != nil {
+			t.Fatalf("invalid time in event %q: %v", line, err)
+		}
+		for _, field := range []string{"v", "time", "duration", "self"} {
+			delete(ev, field)
+		}
+		b, err := json.Marshal(ev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual = append(actual, string(b))
+	}
+	expected := []string{
+		`{"event":"started","id":0,"name":"Recovers"}`,
+		`{"deps":[1],"event":"dependencies","id":0,"name":"Recovers"}`,
+		`{"event":"started","id":1,"name":"flaky 2 flaky"}`,
+		`{"event":"output","id":1,"line":"attempt 1","name":"flaky 2 flaky","stream":"stdout"}`,
+		`{"event":"output","id":1,"line":"--- Attempt 1 of 3 failed: flaky","name":"flaky 2 flaky","stream":"stderr"}`,
+		`{"attempt":2,"error":"flaky","event":"retrying","id":1,"name":"flaky 2 flaky"}`,
+		`{"event":"output","id":1,"line":"attempt 2","name":"flaky 2 flaky","stream":"stdout"}`,
+		`{"event":"output","id":1,"line":"--- Attempt 2 of 3 failed: flaky","name":"flaky 2 flaky","stream":"stderr"}`,
+		`{"attempt":3,"error":"flaky","event":"retrying","id":1,"name":"flaky 2 flaky"}`,
+		`{"event":"output","id":1,"line":"attempt 3","name":"flaky 2 flaky","stream":"stdout"}`,
+		`{"attempts":3,"event":"finished","id":1,"name":"flaky 2 flaky","status":"succeeded"}`,
+		`{"attempts":1,"event":"finished","id":0,"name":"Recovers","status":"succeeded"}`,
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected:\n%s\n\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(actual, "\n"))
+	}
+}
+
+func TestJUnit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	junitFile := filepath.Join(dir, "junit.xml")
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "testdata/junit",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"build"},
+		JUnit:  junitFile,
+	}
+	code := Invoke(inv)
+	if code != 1 {
+		t.Fatalf("expected 1, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+
+	data, err := ioutil.ReadFile(junitFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Tests    int `xml:"tests,attr"`
+		Failures int `xml:"failures,attr"`
+		Suites   []struct {
+			Cases []struct {
+				Name    string `xml:"name,attr"`
+				Failure *struct {
+					Message string `xml:"message,attr"`
+				} `xml:"failure"`
+				SystemOut string `xml:"system-out"`
+				SystemErr string `xml:"system-err"`
+			} `xml:"testcase"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid JUnit report %q: %v", data, err)
+	}
+	if report.Tests != 3 || report.Failures != 1 || len(report.Suites) != 1 {
+		t.Fatalf("expected 3 tests with 1 failure in 1 suite, but got %q", data)
+	}
+	for _, tc := range report.Suites[0].Cases {
+		failure := ""
+		if tc.Failure != nil {
+			failure = tc.Failure.Message
+		}
+		switch tc.Name {
+		case "Build":
+			if failure != "" {
+				t.Fatalf("expected Build not to be marked failed, but got %q", data)
+			}
+		case "Compile":
+			if failure != "" || tc.SystemOut != "compiling\n" {
+				t.Fatalf("expected Compile to succeed with output, but got %q", data)
+			}
+		case "Lint":
+			if failure != "lint failed" || tc.SystemErr != "main.go:1: bad style\n" {
+				t.Fatalf("expected Lint to fail with output, but got %q", data)
+			}
+		default:
+			t.Fatalf("unexpected test case %s in %q", tc.Name, data)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("CACHE_TEST_OUT", dir)
+	defer os.Unsetenv("CACHE_TEST_OUT")
+	defer os.Unsetenv("CACHE_TEST_INPUT")
+	result := filepath.Join(dir, "result.txt")
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "a", expected: "#0001   | generating a\n#0001 SUCCEEDED main.generate{}"},
+		{input: "a", expected: "#0001   | generating a\n#0001 CACHED main.generate{}"},
+		{input: "b", expected: "#0001   | generating b\n#0001 SUCCEEDED main.generate{}"},
+	}
+	for _, tt := range tests {
+		os.Setenv("CACHE_TEST_INPUT", tt.input)
+		if err := os.RemoveAll(result); err != nil {
+			t.Fatal(err)
+		}
+
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		inv := Invocation{
+			Dir:    "testdata/cache",
+			Stdout: stdout,
+			Stderr: stderr,
+			Args:   []string{"generate"},
+		}
+		code := Invoke(inv)
+		if code != 0 {
+			t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+		}
+		if actual := stdout.String(); !strings.Contains(actual, tt.expected) {
+			t.Fatalf("expected %q, but got %q", tt.expected, actual)
+		}
+		data, err := ioutil.ReadFile(result)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != tt.input {
+			t.Fatalf("expected output file to contain %q, but got %q", tt.input, data)
+		}
+	}
+}
+
+func TestUpToDate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv("UPTODATE_DIR", dir)
+	defer os.Unsetenv("UPTODATE_DIR")
+	src := filepath.Join(dir, "src")
+	if err := ioutil.WriteFile(src, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		touch    bool
+		expected string
+	}{
+		{expected: "#0000   | building\n#0000 SUCCEEDED Build"},
+		{expected: "#0000 SKIPPED Build"},
+		{touch: true, expected: "#0000   | building\n#0000 SUCCEEDED Build"},
+	}
+	for _, tt := range tests {
+		if tt.touch {
+			future := time.Now().Add(time.Hour)
+			if err := os.Chtimes(src, future, future); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		inv := Invocation{
+			Dir:    "testdata/uptodate",
+			Stdout: stdout,
+			Stderr: stderr,
+			Args:   []string{"build"},
+		}
+		code := Invoke(inv)
+		if code != 0 {
+			t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+		}
+		if actual := stdout.String(); !strings.Contains(actual, tt.expected) {
+			t.Fatalf("expected %q, but got %q", tt.expected, actual)
+		}
+	}
+}
+
+func TestSh(t *testing.T) {
+	tests := []struct {
+		target   string
+		verbose  bool
+		timeout  time.Duration
+		code     int
+		expected []string
+	}{
+		{
+			target:   "streams",
+			expected: []string{"#0000   | out\n", "#0000 E | err\n"},
+		},
+		{
+			target:   "output",
+			verbose:  true,
+			expected: []string{"#0000   | exec: echo hello\n#0000   | got \"hello\"\n"},
+		},
+		{
+			target: "fail",
+			code:   1,
+			expected: []string{
+				"#0000   | exit status 3\n",
+				"Fail failed: running sh -c \"exit $CODE\" failed with exit code 3\n",
+			},
+		},
+		{
+			target:   "hang",
+			timeout:  500 * time.Millisecond,
+			code:     1,
+			expected: []string{"Hang failed: running sh -c \"sleep 10 & wait\" failed: context deadline exceeded\n"},
+		},
+	}
+	for _, tt := range tests {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		inv := Invocation{
+			Dir:     "testdata/sh",
+			Stdout:  stdout,
+			Stderr:  stderr,
+			Args:    []string{tt.target},
+			Verbose: tt.verbose,
+			Timeout: tt.timeout,
+		}
+		start := time.Now()
+		code := Invoke(inv)
+		if code != tt.code {
+			t.Fatalf("%s: expected %d, but got %v, stderr: %q, stdout: %q", tt.target, tt.code, code, stderr, stdout)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("%s: expected the command to be killed on timeout", tt.target)
+		}
+		actual := stdout.String()
+		for _, expected := range tt.expected {
+			if !strings.Contains(actual, expected) {
+				t.Fatalf("%s: expected %q, but got %q", tt.target, expected, actual)
+			}
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("watch mode is only available under Linux")
+	}
+	watchDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(watchDir)
+	stateDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(stateDir)
+	os.Setenv("WATCH_DIR", watchDir)
+	defer os.Unsetenv("WATCH_DIR")
+	os.Setenv("WATCH_STATE", stateDir)
+	defer os.Unsetenv("WATCH_STATE")
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "testdata/watch",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"build"},
+		Watch:  true,
+	}
+	codeCh := make(chan int, 1)
+	go func() {
+		codeCh <- Invoke(inv)
+	}()
+
+	// Wait for the first run to finish and the watch to start
+	deadline := time.Now().Add(time.Minute)
+	for {
+		if _, err := os.Stat(filepath.Join(stateDir, "runs")); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the first run")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	time.Sleep(time.Second)
+
+	if err := ioutil.WriteFile(filepath.Join(watchDir, "input"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case code := <-codeCh:
+		if code != 0 {
+			t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("timed out waiting for the second run")
+	}
+	actual := stdout.String()
+	for _, expected := range []string{
+		"#0000   | run 1\n#0000 SUCCEEDED Build",
+		"Watching for changes...\n" + filepath.Join(watchDir, "input") + " changed, running again\n",
+		"#0000   | run 2\n",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("expected %q, but got %q", expected, actual)
+		}
+	}
+}
+
+// syncBuffer is a buffer safe to read while a watching run writes to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitFor polls until the condition holds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(time.Minute)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// watchRuns returns the number of runs of the testdata/watch targets so far
+func watchRuns(stateDir string) int {
+	data, _ := ioutil.ReadFile(filepath.Join(stateDir, "runs"))
+	return len(data)
+}
+
+func TestWatchCancel(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("watch mode is only available under Linux")
+	}
+	watchDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(watchDir)
+	stateDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(stateDir)
+	os.Setenv("WATCH_DIR", watchDir)
+	defer os.Unsetenv("WATCH_DIR")
+	os.Setenv("WATCH_STATE", stateDir)
+	defer os.Unsetenv("WATCH_STATE")
+
+	stdout := &syncBuffer{}
+	stderr := &syncBuffer{}
+	inv := Invocation{
+		Dir:    "testdata/watch",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"slow"},
+		Watch:  true,
+	}
+	codeCh := make(chan int, 1)
+	go func() {
+		codeCh <- Invoke(inv)
+	}()
+
+	input := filepath.Join(watchDir, "input")
+	waitFor(t, "the first run", func() bool {
+		return strings.Contains(stdout.String(), "Watching for changes...")
+	})
+	time.Sleep(time.Second)
+	if err := ioutil.WriteFile(input, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second run waits until it is cancelled by the next change
+	waitFor(t, "the second run", func() bool { return watchRuns(stateDir) == 2 })
+	time.Sleep(time.Second)
+	if err := ioutil.WriteFile(input, []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case code := <-codeCh:
+		if code != 0 {
+			t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("timed out waiting for the third run")
+	}
+	actual := stdout.String()
+	for _, expected := range []string{
+		"#0000   | run 2\n",
+		"#0000   | run 2 cancelled\n",
+		input + " changed, running again\n",
+		"#0000   | run 3\n",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("expected %q, but got %q", expected, actual)
+		}
+	}
+	if strings.Contains(actual, "Watching for changes...\n"+input+" changed, running again\n#0000   | run 3") {
+		t.Fatalf("expected the second run to be cancelled, but it has finished: %q", actual)
+	}
+}
+
+func TestWatchOutputs(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("watch mode is only available under Linux")
+	}
+	watchDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(watchDir)
+	stateDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(stateDir)
+	os.Setenv("WATCH_DIR", watchDir)
+	defer os.Unsetenv("WATCH_DIR")
+	os.Setenv("WATCH_STATE", stateDir)
+	defer os.Unsetenv("WATCH_STATE")
+
+	stdout := &syncBuffer{}
+	stderr := &syncBuffer{}
+	inv := Invocation{
+		Dir:    "testdata/watch",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"generate"},
+		Watch:  true,
+	}
+	codeCh := make(chan int, 1)
+	go func() {
+		codeCh <- Invoke(inv)
+	}()
+
+	input := filepath.Join(watchDir, "input")
+	waitFor(t, "the first run", func() bool {
+		return strings.Contains(stdout.String(), "Watching for changes...")
+	})
+	time.Sleep(time.Second)
+	if err := ioutil.WriteFile(input, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second run writes its output under the watched directory, which
+	// must not cancel it
+	waitFor(t, "the second run", func() bool {
+		return strings.Count(stdout.String(), "Watching for changes...") == 2
+	})
+	time.Sleep(time.Second)
+	if err := ioutil.WriteFile(input, []byte("changed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case code := <-codeCh:
+		if code != 0 {
+			t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("timed out waiting for the third run")
+	}
+	actual := stdout.String()
+	for _, expected := range []string{
+		"#0000   | run 2\n#0000 SUCCEEDED Generate",
+		"#0000   | run 3\n",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("expected %q, but got %q", expected, actual)
+		}
+	}
+	if strings.Contains(actual, "out changed") || strings.Contains(actual, "CANCELLED") {
+		t.Fatalf("expected the output of the task to be ignored, but got %q", actual)
+	}
+}
+
+func TestWatchRebuild(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("watch mode is only available under Linux")
+	}
+	watchDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(watchDir)
+	stateDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(stateDir)
+	os.Setenv("WATCH_DIR", watchDir)
+	defer os.Unsetenv("WATCH_DIR")
+	os.Setenv("WATCH_STATE", stateDir)
+	defer os.Unsetenv("WATCH_STATE")
+
+	// The gamefile is edited by the test, so it has to be a copy. It is kept
+	// under testdata to be a part of the module.
+	dir, err := ioutil.TempDir("testdata", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	original, err := ioutil.ReadFile("testdata/watch/gamefile.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gamefile := filepath.Join(dir, "gamefile.go")
+	if err := ioutil.WriteFile(gamefile, original, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout := &syncBuffer{}
+	stderr := &syncBuffer{}
+	inv := Invocation{
+		Dir:    dir,
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"build"},
+		Watch:  true,
+	}
+	codeCh := make(chan int, 1)
+	go func() {
+		codeCh <- Invoke(inv)
+	}()
+
+	waitFor(t, "the first run", func() bool {
+		return strings.Contains(stdout.String(), "Watching for changes...")
+	})
+	time.Sleep(time.Second)
+
+	// A broken gamefile does not end the watch
+	if err := ioutil.WriteFile(gamefile, append(original, "func Broken() { undefined() }\n"...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the failed build", func() bool {
+		return strings.Contains(stdout.String(), "Waiting for gamefiles to change...")
+	})
+	time.Sleep(time.Second)
+
+	fixed := strings.Replace(string(original), `"run %d\n"`, `"rebuilt run %d\n"`, 1)
+	if err := ioutil.WriteFile(gamefile, []byte(fixed), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case code := <-codeCh:
+		if code != 0 {
+			t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+		}
+	case <-time.After(time.Minute):
+		t.Fatal("timed out waiting for the rebuilt run")
+	}
+	absGamefile, err := filepath.Abs(gamefile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual := stdout.String()
+	for _, expected := range []string{
+		"#0000   | run 1\n",
+		"Watching for changes...\n" + absGamefile + " changed, rebuilding\n",
+		"Waiting for gamefiles to change...\n" + absGamefile + " changed, rebuilding\n",
+		"#0000   | rebuilt run 2\n",
+	} {
+		if !strings.Contains(actual, expected) {
+			t.Fatalf("expected %q, but got %q", expected, actual)
+		}
+	}
+	if !strings.Contains(stderr.String(), "Error: error compiling gamefiles") {
+		t.Fatalf("expected a compile error, but got %q", stderr)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		code := ParseAndRun(stdout, stderr, nil, []string{"-completion", shell})
+		if code != 0 {
+			t.Fatalf("%s: expected 0, but got %v, stderr: %q, stdout: %q", shell, code, stderr, stdout)
+		}
+		actual := stdout.String()
+		for _, expected := range []string{"-complete-targets", "goos", "freebsd illumos", "fail-fast"} {
+			if !strings.Contains(actual, expected) {
+				t.Fatalf("%s: expected %q in completion script, but got %q", shell, expected, actual)
+			}
+		}
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	code := ParseAndRun(stdout, stderr, nil, []string{"-completion", "tcsh"})
+	if code != 2 {
+		t.Fatalf("expected 2, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	expected := "Error: unsupported shell \"tcsh\" for completion, must be bash, zsh or fish\n"
+	if stderr.String() != expected {
+		t.Fatalf("expected %q, but got %q", expected, stderr)
+	}
+}
+
+func TestCompleteTargets(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:             "testdata/namespaces",
+		Stdout:          stdout,
+		Stderr:          stderr,
+		CompleteTargets: true,
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	expected := "ns:bareCtx\ntestNamespaceDep\n"
+	if stdout.String() != expected {
+		t.Fatalf("expected %q, but got %q", expected, stdout)
+	}
+}
+
+func TestSuggestTargets(t *testing.T) {
+	tests := []struct {
+		target string
+		prefix bool
+		code   int
+		stdout string
+		stderr string
+	}{
+		{target: "biuld", code: 2, stderr: "Unknown target specified: biuld\nDid you mean build?\n"},
+		{target: "upload", code: 2, stderr: "Unknown target specified: upload\nDid you mean deploy:upload?\n"},
+		{target: "dep:up", code: 2, stderr: "Unknown target specified: dep:up\nDid you mean one of deploy:update, deploy:upload?\n"},
+		{target: "frobnicate", code: 2, stderr: "Unknown target specified: frobnicate\n"},
+		{target: "dep:upl", prefix: true, stdout: "uploading\n"},
+		{target: "Deploy:Upload", prefix: true, stdout: "uploading\n"},
+		{target: "dep:up", prefix: true, code: 2, stderr: "Ambiguous target specified: dep:up matches deploy:update, deploy:upload\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			inv := Invocation{
+				Dir:    "./testdata/suggest",
+				Stdout: stdout,
+				Stderr: stderr,
+				Prefix: tt.prefix,
+				Args:   []string{tt.target},
+			}
+			if code := Invoke(inv); code != tt.code {
+				t.Fatalf("expected exit code %d, but got %d, stderr: %s", tt.code, code, stderr)
+			}
+			if actual := stdout.String(); !strings.Contains(actual, tt.stdout) {
+				t.Errorf("expected stdout to contain %q, but got %q", tt.stdout, actual)
+			}
+			if actual := stderr.String(); actual != tt.stderr {
+				t.Errorf("expected stderr %q, but got %q", tt.stderr, actual)
+			}
+		})
+	}
+}
+
+func TestAliases(t *testing.T) {
+	tests := []struct {
+		target string
+		stdout string
+	}{
+		{target: "i", stdout: "installing\n"},
+		{target: "INST", stdout: "installing\n"},
+		{target: "up", stdout: "uploading\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			stderr := &bytes.Buffer{}
+			inv := Invocation{
+				Dir:    "./testdata/aliases",
+				Stdout: stdout,
+				Stderr: stderr,
+				Args:   []string{tt.target},
+			}
+			if code := Invoke(inv); code != 0 {
+				t.Fatalf("expected to exit with code 0, but got %v, stderr: %s", code, stderr)
+			}
+			if actual := stdout.String(); !strings.Contains(actual, tt.stdout) {
+				t.Errorf("expected stdout to contain %q, but got %q", tt.stdout, actual)
+			}
+		})
+	}
+}
+
+func TestListAliases(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "./testdata/aliases",
+		Stdout: stdout,
+		Stderr: ioutil.Discard,
+		List:   true,
+	}
+	if code := Invoke(inv); code != 0 {
+		t.Errorf("expected to exit with code 0, but got %v", code)
+	}
+	expected := `
+Targets:
+  install (aliases: i, inst)    installs the binary.
+
+deploy
+  deploy:upload (alias: up)    uploads the binary.
+`[1:]
+	if actual := stdout.String(); actual != expected {
+		t.Fatalf("expected:\n%v\n\ngot:\n%v", expected, actual)
+	}
+}
+
+func TestHelpAliases(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "./testdata/aliases",
+		Stdout: stdout,
+		Stderr: ioutil.Discard,
+		Help:   true,
+		Args:   []string{"i"},
+	}
+	if code := Invoke(inv); code != 0 {
+		t.Errorf("expected to exit with code 0, but got %v", code)
+	}
+	expected := "game install:\n\nInstall installs the binary.\n\nAliases: i, inst\n\n"
+	if actual := stdout.String(); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+}
+
+func TestHiddenTargets(t *testing.T) {
+	tests := []struct {
+		all      bool
+		expected string
+	}{
+		{all: false, expected: `
+Targets:
+  build      builds everything.
+  compile    is the old name of Build.
+  release    builds a release.
+`[1:]},
+		{all: true, expected: `
+Targets:
+  build       builds everything.
+  compile     is the old name of Build.
+  generate    generates sources for Build.
+  release     builds a release.
+`[1:]},
+	}
+	for _, tt := range tests {
+		stdout := &bytes.Buffer{}
+		inv := Invocation{
+			Dir:     "./testdata/directives",
+			Stdout:  stdout,
+			Stderr:  ioutil.Discard,
+			List:    true,
+			ListAll: tt.all,
+		}
+		if code := Invoke(inv); code != 0 {
+			t.Errorf("expected to exit with code 0, but got %v", code)
+		}
+		if actual := stdout.String(); actual != tt.expected {
+			t.Errorf("expected:\n%v\n\ngot:\n%v", tt.expected, actual)
+		}
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "./testdata/directives",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"generate"},
+	}
+	if code := Invoke(inv); code != 0 {
+		t.Fatalf("expected hidden target to run, but got exit code %v, stderr: %s", code, stderr)
+	}
+	if actual := stdout.String(); !strings.Contains(actual, "generating\n") {
+		t.Errorf("expected hidden target to run, but got %q", actual)
+	}
+
+	// Hidden targets are neither matched by prefixes nor suggested
+	stdout.Reset()
+	stderr.Reset()
+	inv.Args = []string{"generat"}
+	inv.Prefix = true
+	if code := Invoke(inv); code != 2 {
+		t.Fatalf("expected to exit with code 2, but got %v, stdout: %q, stderr: %q", code, stdout, stderr)
+	}
+	if expected := "Unknown target specified: generat\n"; stderr.String() != expected {
+		t.Errorf("expected stderr %q, but got %q", expected, stderr)
+	}
+}
+
+func TestDeprecatedTargets(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "./testdata/directives",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"compile"},
+	}
+	if code := Invoke(inv); code != 0 {
+		t.Fatalf("expected to exit with code 0, but got %v, stderr: %s", code, stderr)
+	}
+	actual := stdout.String()
+	for _, expected := range []string{"warning: target compile is deprecated, use build\n", "building\n"} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("expected output to contain %q, but got %q", expected, actual)
+		}
+	}
+
+	// Deprecated targets warn when run as dependencies too
+	stdout.Reset()
+	inv.Args = []string{"release"}
+	if code := Invoke(inv); code != 0 {
+		t.Fatalf("expected to exit with code 0, but got %v, stderr: %s", code, stderr)
+	}
+	actual = stdout.String()
+	for _, expected := range []string{"warning: target compile is deprecated, use build\n", "releasing\n"} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("expected output to contain %q, but got %q", expected, actual)
+		}
+	}
+
+	stdout.Reset()
+	inv.Args = []string{"build"}
+	if code := Invoke(inv); code != 0 {
+		t.Fatalf("expected to exit with code 0, but got %v, stderr: %s", code, stderr)
+	}
+	if actual := stdout.String(); strings.Contains(actual, "deprecated") {
+		t.Errorf("expected no deprecation warning, but got %q", actual)
+	}
+}
+
+func TestListJSON(t *testing.T) {
+	type arg struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	type target struct {
+		Name      string `json:"name"`
+		Synopsis  string `json:"synopsis"`
+		Comment   string `json:"comment"`
+		Default   bool   `json:"default"`
+		Namespace string `json:"namespace"`
+		Import    string `json:"import"`
+		Args      []arg  `json:"args"`
+	}
+	list := func(dir string) map[string]target {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		inv := Invocation{
+			Dir:        dir,
+			Stdout:     stdout,
+			Stderr:     stderr,
+			List:       true,
+			ListFormat: "json",
+		}
+		if code := Invoke(inv); code != 0 {
+			t.Fatalf("expected to exit with code 0, but got %v, stderr: %s", code, stderr)
+		}
+		var out struct {
+			Description string   `json:"description"`
+			Targets     []target `json:"targets"`
+		}
+		if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+			t.Fatalf("failed to decode %q: %v", stdout, err)
+		}
+		targets := map[string]target{}
+		for _, target := range out.Targets {
+			targets[target.Name] = target
+		}
+		return targets
+	}
+
+	targets := list("./testdata/gameimport")
+	expected := target{
+		Name:      "zz:ns:deploy2",
+		Synopsis:  "deploys stuff.",
+		Comment:   "Deploy2 deploys stuff.",
+		Default:   true,
+		Namespace: "ns",
+		Import:    "zz",
+	}
+	if actual := targets[expected.Name]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, but got %+v", expected, actual)
+	}
+
+	targets = list("./testdata/args")
+	expected = target{
+		Name:     "deploy",
+		Synopsis: "deploys the given number of replicas to the environment.",
+		Comment:  "Deploy deploys the given number of replicas to the environment.",
+		Args: []arg{
+			{Name: "env", Type: "string"},
+			{Name: "replicas", Type: "int"},
+			{Name: "dryRun", Type: "bool"},
+		},
+	}
+	if actual := targets[expected.Name]; !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %+v, but got %+v", expected, actual)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	traceFile := filepath.Join(dir, "trace.json")
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "testdata/junit",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"build"},
+		Trace:  traceFile,
+	}
+	if code := Invoke(inv); code != 1 {
+		t.Fatalf("expected 1, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+
+	data, err := ioutil.ReadFile(traceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []struct {
+		Name     string            `json:"name"`
+		Category string            `json:"cat"`
+		Type     string            `json:"ph"`
+		ThreadID int               `json:"tid"`
+		Args     map[string]string `json:"args"`
+		ID       int               `json:"id"`
+	}
+	if err := json.Unmarshal(data, &events); err != nil {
+		t.Fatal(err)
+	}
+
+	threads := map[string]int{}
+	for _, e := range events {
+		if e.Name == "thread_name" {
+			// task names are prefixed with their IDs
+			name := strings.Fields(e.Args["name"])
+			threads[strings.ToLower(name[len(name)-1])] = e.ThreadID
+		}
+	}
+	build, compile, lint := threads["build"], threads["compile"], threads["lint"]
+	if len(threads) != 3 {
+		t.Fatalf("expected threads of build, compile and lint, but got %v", threads)
+	}
+
+	var labels string
+	var waits int
+	flowStarts := map[int]int{}
+	flowEnds := map[int]int{}
+	var lintLines []string
+	for _, e := range events {
+		switch {
+		case e.Name == "process_labels":
+			labels = e.Args["labels"]
+		case e.Type == "X" && e.Category == "wait":
+			if e.ThreadID != build {
+				t.Errorf("expected only build to wait, but got a wait span of thread %d", e.ThreadID)
+			}
+			waits++
+		case e.Type == "s":
+			flowStarts[e.ID] = e.ThreadID
+		case e.Type == "f":
+			flowEnds[e.ID] = e.ThreadID
+		case e.Type == "I" && e.Category == "stderr" && e.ThreadID == lint:
+			lintLines = append(lintLines, e.Args["line"])
+		}
+	}
+	if labels != "build" {
+		t.Errorf("expected process labels %q, but got %q", "build", labels)
+	}
+	if waits != 1 {
+		t.Errorf("expected 1 wait span, but got %d", waits)
+	}
+	var deps []int
+	for id, from := range flowStarts {
+		if from != build {
+			t.Errorf("expected flow %d to start at build, but it starts at thread %d", id, from)
+		}
+		deps = append(deps, flowEnds[id])
+	}
+	sort.Ints(deps)
+	expected := []int{compile, lint}
+	sort.Ints(expected)
+	if !reflect.DeepEqual(deps, expected) {
+		t.Errorf("expected flows from build to compile and lint, but got flows to %v", deps)
+	}
+	if expected := []string{"main.go:1: bad style"}; !reflect.DeepEqual(lintLines, expected) {
+		t.Errorf("expected stderr lines %q of lint, but got %q", expected, lintLines)
+	}
+}
+
+func TestTraceFlows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	traceFile := filepath.Join(dir, "trace.json")
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "testdata/traceflows",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"build"},
+		Trace:  traceFile,
+	}
+	if code := Invoke(inv); code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+
+	data, err := ioutil.ReadFile(traceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []struct {
+		Name      string            `json:"name"`
+		Type      string            `json:"ph"`
+		ThreadID  int               `json:"tid"`
+		Timestamp int64             `json:"ts"`
+		Args      map[string]string `json:"args"`
+		ID        int               `json:"id"`
+	}
+	if err := json.Unmarshal(data, &events); err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[int]string{}
+	for _, e := range events {
+		if e.Name == "thread_name" {
+			name := strings.Fields(e.Args["name"])
+			names[e.ThreadID] = strings.ToLower(name[len(name)-1])
+		}
+	}
+	starts := map[int]int64{}
+	from := map[int]string{}
+	var flows []string
+	for _, e := range events {
+		switch e.Type {
+		case "s":
+			starts[e.ID] = e.Timestamp
+			from[e.ID] = names[e.ThreadID]
+		case "f":
+			if e.Timestamp < starts[e.ID] {
+				t.Errorf("expected flow %d to %s to go forward in time, but it goes from %d to %d", e.ID, names[e.ThreadID], starts[e.ID], e.Timestamp)
+			}
+			flows = append(flows, from[e.ID]+" -> "+names[e.ThreadID])
+		}
+	}
+	sort.Strings(flows)
+	// Lint waits for generate too, but it has been started by compile
+	expected := []string{"build -> compile", "build -> lint", "compile -> generate"}
+	if !reflect.DeepEqual(flows, expected) {
+		t.Errorf("expected flows %q, but got %q", expected, flows)
+	}
+}
+func TestSummary(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:     "testdata/summary",
+		Stdout:  stdout,
+		Stderr:  stderr,
+		Args:    []string{"build"},
+		Summary: true,
+	}
+	if code := Invoke(inv); code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	actual := stdout.String()
+	for _, expected := range []string{
+		`\n  wall time \d+\.\d\ds, compute time \d+\.\d\ds, parallelism \d+\.\d\dx\n`,
+		`\nCritical path:\n  Build +self=\d+\.\d\ds\n      Slow +self=0\.[23]\ds\n          Generate +self=0\.[12]\ds\n`,
+		`\nSlowest tasks:\n  Slow +0\.[23]\ds\n  Generate +0\.[12]\ds\n  Fast +\d+\.\d\ds\n  Build +\d+\.\d\ds\n`,
+		`\nLongest waits for a single dependency:\n  Build waited 0\.[23]\ds for Slow\n  Slow waited 0\.[12]\ds for Generate\n`,
+	} {
+		if !regexp.MustCompile(expected).MatchString(actual) {
+			t.Errorf("expected output to match %q, but got %q", expected, actual)
+		}
+	}
+}
+
+func TestGrouped(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:     "testdata/grouped",
+		Stdout:  stdout,
+		Stderr:  stderr,
+		Args:    []string{"build"},
+		Grouped: true,
+	}
+	if code := Invoke(inv); code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	actual := stdout.String()
+	for _, expected := range []string{
+		`#\d{4}   \| first 1\n#\d{4}   \| first 2\n#\d{4} SUCCEEDED First `,
+		`#\d{4}   \| second 1\n#\d{4}   \| second 2\n#\d{4} SUCCEEDED Second `,
+	} {
+		if !regexp.MustCompile(expected).MatchString(actual) {
+			t.Errorf("expected output to match %q, but got %q", expected, actual)
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	if err := os.RemoveAll(filepath.Join(mg.CacheDir(), "history")); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("SLEEP")
+
+	run := func(sleep string, inv Invocation) (int, string, string) {
+		os.Setenv("SLEEP", sleep)
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		inv.Dir = "testdata/history"
+		inv.Stdout = stdout
+		inv.Stderr = stderr
+		code := Invoke(inv)
+		return code, stdout.String(), stderr.String()
+	}
+
+	for i := 0; i < 3; i++ {
+		if code, stdout, stderr := run("10ms", Invocation{Args: []string{"sleep"}}); code != 0 || stderr != "" {
+			t.Fatalf("expected 0 and no stderr, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+		}
+	}
+
+	code, stdout, stderr := run("500ms", Invocation{Args: []string{"sleep"}})
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	expected := `^warning: Sleep took 0\.\d\ds, \d+\.\dx its median of 0\.0\ds over the last 3 runs\n$`
+	if !regexp.MustCompile(expected).MatchString(stderr) {
+		t.Errorf("expected stderr to match %q, but got %q", expected, stderr)
+	}
+
+	code, stdout, stderr = run("", Invocation{History: "sleep"})
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	expected = `^Recent timings of Sleep:\n(  \d{4}-\d\d-\d\d \d\d:\d\d:\d\d +0\.0\ds\n){3}  \d{4}-\d\d-\d\d \d\d:\d\d:\d\d +0\.\d\ds\nMedian 0\.0\ds over 4 runs\n$`
+	if !regexp.MustCompile(expected).MatchString(stdout) {
+		t.Errorf("expected stdout to match %q, but got %q", expected, stdout)
+	}
+
+	code, stdout, stderr = run("", Invocation{History: "nope"})
+	if code != 2 {
+		t.Fatalf("expected 2, but got %v, stderr: %q, stdout: %q", code, stderr, stdout)
+	}
+	if expected := "No timings of task nope recorded\n"; stderr != expected {
+		t.Errorf("expected stderr %q, but got %q", expected, stderr)
+	}
+}
+
+// otlpSpan is the part of a span exported over OTLP/HTTP checked by tests
+type otlpSpan struct {
+	TraceID      string `json:"traceId"`
+	SpanID       string `json:"spanId"`
+	ParentSpanID string `json:"parentSpanId"`
+	Name         string `json:"name"`
+	Links        []struct {
+		SpanID string `json:"spanId"`
+	} `json:"links"`
+	Status struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+func TestOTLP(t *testing.T) {
+	requests := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		requests <- body
+	}))
+	defer server.Close()
+
+	const traceID = "0af7651916cd43dd8448eb211c80319c"
+	const parentID = "b7ad6b7169203331"
+	os.Setenv(mg.OTLPEndpointEnv, server.URL)
+	defer os.Unsetenv(mg.OTLPEndpointEnv)
+	os.Setenv(mg.TraceParentEnv, "00-"+traceID+"-"+parentID+"-01")
+	defer os.Unsetenv(mg.TraceParentEnv)
+
+	invoke := func(target string) (int, string, map[string]otlpSpan) {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		inv := Invocation{
+			Dir:    "testdata/otlp",
+			Stdout: stdout,
+			Stderr: stderr,
+			Args:   []string{target},
+		}
+		code := Invoke(inv)
+
+		var req struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []otlpSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		select {
+		case body := <-requests:
+			if err := json.Unmarshal(body, &req); err != nil {
+				t.Fatalf("failed to parse request: %v, body: %s", err, body)
+			}
+		default:
+			t.Fatalf("no spans exported, stderr: %q, stdout: %q", stderr, stdout)
+		}
+		spans := map[string]otlpSpan{}
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					if span.TraceID != traceID {
+						t.Errorf("expected span %s in trace %s, but got %s", span.Name, traceID, span.TraceID)
+					}
+					spans[span.Name+"/"+span.SpanID] = span
+				}
+			}
+		}
+		return code, stdout.String(), spans
+	}
+	byName := func(spans map[string]otlpSpan, name string) []otlpSpan {
+		var found []otlpSpan
+		for _, span := range spans {
+			if span.Name == name {
+				found = append(found, span)
+			}
+		}
+		return found
+	}
+	one := func(spans map[string]otlpSpan, name string) otlpSpan {
+		found := byName(spans, name)
+		if len(found) != 1 {
+			t.Fatalf("expected one span %s, but got %d: %v", name, len(found), spans)
+		}
+		return found[0]
+	}
+
+	code, stdout, spans := invoke("build")
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stdout: %q", code, stdout)
+	}
+	run := one(spans, "game")
+	if run.ParentSpanID != parentID {
+		t.Errorf("expected the run to be a child of %s, but got %s", parentID, run.ParentSpanID)
+	}
+	build := one(spans, "Build")
+	check := one(spans, "Check")
+	generate := one(spans, "Generate")
+	if build.ParentSpanID != run.SpanID {
+		t.Errorf("expected Build to be a child of the run, but got %s", build.ParentSpanID)
+	}
+	if check.ParentSpanID != build.SpanID || generate.ParentSpanID != build.SpanID {
+		t.Errorf("expected Check and Generate to be children of Build, but got %s and %s",
+			check.ParentSpanID, generate.ParentSpanID)
+	}
+	if len(generate.Links) != 1 || generate.Links[0].SpanID != check.SpanID {
+		t.Errorf("expected Generate to be linked to Check, but got %v", generate.Links)
+	}
+	if build.Status.Code != 1 {
+		t.Errorf("expected OK status of Build, but got %v", build.Status)
+	}
+	computes := 0
+	for _, span := range byName(spans, "compute") {
+		if span.ParentSpanID == generate.SpanID {
+			computes++
+		}
+	}
+	if computes != 1 {
+		t.Errorf("expected one compute span of Generate, but got %d", computes)
+	}
+	waits := 0
+	for _, span := range byName(spans, "wait") {
+		if span.ParentSpanID == build.SpanID {
+			waits++
+			if len(span.Links) != 2 {
+				t.Errorf("expected the wait span of Build to be linked to 2 subtasks, but got %v", span.Links)
+			}
+		}
+	}
+	if waits != 1 {
+		t.Errorf("expected one wait span of Build, but got %d", waits)
+	}
+	if expected := "traceparent=00-" + traceID + "-" + generate.SpanID + "-01\n"; !strings.Contains(stdout, expected) {
+		t.Errorf("expected stdout to contain %q, but got %q", expected, stdout)
+	}
+
+	code, stdout, spans = invoke("fail")
+	if code != 1 {
+		t.Fatalf("expected 1, but got %v, stdout: %q", code, stdout)
+	}
+	if fail := one(spans, "Fail"); fail.Status.Code != 2 || fail.Status.Message != "boom" {
+		t.Errorf("expected error status of Fail, but got %v", fail.Status)
+	}
+}
+
 func TestParseHelp(t *testing.T) {
 	buf := &bytes.Buffer{}
 	_, _, err := Parse(ioutil.Discard, buf, []string{"-h"})
@@ -1058,6 +2716,14 @@ func TestClean(t *testing.T) {
 	if len(files) < 1 {
 		t.Error("Need at least 1 cached binaries to test --clean")
 	}
+	for _, dir := range []string{mg.TasksCacheDir, mg.HistoryCacheDir} {
+		if err := os.MkdirAll(filepath.Join(mg.CacheDir(), dir, "ab"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(mg.CacheDir(), dir, "ab", "entry"), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
 
 	_, cmd, err := Parse(ioutil.Discard, ioutil.Discard, []string{"-clean"})
 	if err != nil {
@@ -1087,6 +2753,111 @@ func TestClean(t *testing.T) {
 	if len(names) != 0 {
 		t.Errorf("expected '-clean' to remove files from CACHE_DIR, but still have %v", names)
 	}
+	for _, dir := range []string{mg.TasksCacheDir, mg.HistoryCacheDir} {
+		if _, err := os.Stat(filepath.Join(mg.CacheDir(), dir)); !os.IsNotExist(err) {
+			t.Errorf("expected '-clean' to remove %s from CACHE_DIR, but got %v", dir, err)
+		}
+	}
+}
+
+func TestInit(t *testing.T) {
+	dir, err := ioutil.TempDir("./testdata", "init")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	code := ParseAndRun(stdout, stderr, nil, []string{"-init", "-d", dir})
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr:\n%s", code, stderr)
+	}
+	if expected := initFile + " created\n"; stdout.String() != expected {
+		t.Fatalf("expected %q, but got %q", expected, stdout)
+	}
+	if stderr.String() != "" {
+		t.Fatalf("expected no warnings inside a module, but got %q", stderr)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	code = Invoke(Invocation{
+		Dir:    dir,
+		Stdout: stdout,
+		Stderr: stderr,
+		List:   true,
+	})
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr:\n%s", code, stderr)
+	}
+	expected := `
+Targets:
+  build*    builds the project after installing dependencies.
+  clean     removes build artifacts.
+
+deps - Deps groups dependency management targets.
+  deps:install    installs dependencies.
+
+* default target
+`[1:]
+	if actual := stdout.String(); actual != expected {
+		t.Fatalf("expected:\n%q\n\ngot:\n%q", expected, actual)
+	}
+
+	stderr.Reset()
+	code = ParseAndRun(ioutil.Discard, stderr, nil, []string{"-init", "-d", dir})
+	if code != 1 {
+		t.Fatalf("expected 1 when gamefiles already exist, but got %v", code)
+	}
+	if expected := "Error: gamefiles already exist: "; !strings.HasPrefix(stderr.String(), expected) {
+		t.Fatalf("expected %q, but got %q", expected, stderr)
+	}
+}
+
+func TestInitOutsideModule(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stderr := &bytes.Buffer{}
+	code := ParseAndRun(ioutil.Discard, stderr, nil, []string{"-init", "-d", dir})
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr:\n%s", code, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, initFile)); err != nil {
+		t.Fatalf("expected %s to be created, but got %v", initFile, err)
+	}
+	if expected := "is not inside a Go module"; !strings.Contains(stderr.String(), expected) {
+		t.Fatalf("expected %q, but got %q", expected, stderr)
+	}
+
+	code = ParseAndRun(ioutil.Discard, ioutil.Discard, nil, []string{"-init", "-d", dir})
+	if code != 1 {
+		t.Fatalf("expected 1 when %s already exists, but got %v", initFile, code)
+	}
+
+	// Gamefiles with other names are found outside of modules too
+	if err := os.Remove(filepath.Join(dir, initFile)); err != nil {
+		t.Fatal(err)
+	}
+	buildFile := filepath.Join(dir, "build.go")
+	if err := ioutil.WriteFile(buildFile, []byte("//go:build game\n\npackage main\n\nfunc Build() {}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	code = ParseAndRun(ioutil.Discard, stderr, nil, []string{"-init", "-d", dir})
+	if code != 1 {
+		t.Fatalf("expected 1 when %s exists, but got %v, stderr:\n%s", buildFile, code, stderr)
+	}
+	if expected := "gamefiles already exist: " + buildFile; !strings.Contains(stderr.String(), expected) {
+		t.Fatalf("expected %q, but got %q", expected, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, initFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected %s not to be created, but got %v", initFile, err)
+	}
 }
 
 func TestGoCmd(t *testing.T) {
@@ -1289,6 +3060,112 @@ func TestVarDep(t *testing.T) {
 	}
 }
 
+func TestArgs(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "./testdata/args",
+		Stdout: stdout,
+		Stderr: stderr,
+		Args:   []string{"deploy", "prod", "3", "true", "status", "wait", "1m30s", "0.5", "ns:say", "hi"},
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v, stderr:\n%s", code, stderr)
+	}
+	for _, expected := range []string{"deploy prod 3 true\n", "status\n", "wait 1m30s 0.5\n", "say hi\n"} {
+		if !strings.Contains(stdout.String(), expected) {
+			t.Fatalf("expected %q, but got %q", expected, stdout.String())
+		}
+	}
+}
+
+func TestArgsErrors(t *testing.T) {
+	tests := []struct {
+		args     []string
+		code     int
+		expected string
+	}{
+		{
+			args:     []string{"deploy", "prod", "3"},
+			code:     2,
+			expected: "Not enough arguments for target deploy: expected 3, got 2\nUsage: deploy <env> <replicas> <dryRun>\n",
+		},
+		{
+			args:     []string{"deploy", "prod", "many", "false"},
+			code:     2,
+			expected: "Invalid value \"many\" of argument replicas (int) for target deploy: strconv.Atoi: parsing \"many\": invalid syntax\n",
+		},
+		{
+			args:     []string{"wait", "soon", "1"},
+			code:     2,
+			expected: "Invalid value \"soon\" of argument d (time.Duration) for target wait: time: invalid duration \"soon\"\n",
+		},
+	}
+	for _, tt := range tests {
+		stderr := &bytes.Buffer{}
+		inv := Invocation{
+			Dir:    "./testdata/args",
+			Stdout: ioutil.Discard,
+			Stderr: stderr,
+			Args:   tt.args,
+		}
+		code := Invoke(inv)
+		if code != tt.code {
+			t.Errorf("%q: expected %d, but got %v", tt.args, tt.code, code)
+		}
+		if actual := stderr.String(); actual != tt.expected {
+			t.Errorf("%q: expected %q, but got %q", tt.args, tt.expected, actual)
+		}
+	}
+}
+
+func TestArgsList(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "./testdata/args",
+		Stdout: stdout,
+		Stderr: ioutil.Discard,
+		List:   true,
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v", code)
+	}
+	expected := `
+Targets:
+  deploy <env> <replicas> <dryRun>    deploys the given number of replicas to the environment.
+  status                              
+  wait <d> <ratio>                    waits for the given duration.
+
+ns
+  ns:say <msg>    
+`[1:]
+	if actual := stdout.String(); actual != expected {
+		t.Fatalf("expected:\n%q\n\ngot:\n%q", expected, actual)
+	}
+}
+
+func TestArgsHelp(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	inv := Invocation{
+		Dir:    "./testdata/args",
+		Stdout: stdout,
+		Stderr: ioutil.Discard,
+		Args:   []string{"deploy"},
+		Help:   true,
+	}
+	code := Invoke(inv)
+	if code != 0 {
+		t.Fatalf("expected 0, but got %v", code)
+	}
+	expected := "game deploy:\n\nDeploy deploys the given number of replicas to the environment.\n\n" +
+		"Usage:\n\n\tgame deploy <env> <replicas> <dryRun>\n\n"
+	if actual := stdout.String(); actual != expected {
+		t.Fatalf("expected %q, but got %q", expected, actual)
+	}
+}
+
 var wrongDepRx = regexp.MustCompile("Invalid type for a task function.*@ main.FooBar .*gamefile.go")
 
 func TestWrongDependency(t *testing.T) {
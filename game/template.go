@@ -20,14 +20,30 @@ func main() {
 		toplevel.Target{Name: {{lowerFirst .TargetName | printf "%q"}},
 			Fn: {{.FnName}},
 			Synopsis: {{printf "%q" .Synopsis}},
-			Comment: {{printf "%q" .Comment}}},
+			Comment: {{printf "%q" .Comment}},
+			{{- template "args" .Args}}
+			{{- template "aliases" index $.Aliases .}}
+{{- if .Namespace}}
+			Namespace: {{lowerFirst .Namespace | printf "%q"}},
+			NamespaceComment: {{printf "%q" .NamespaceComment}},
+{{- end}}
+			{{- template "import" .Import}}
+			{{- template "directives" .Directives}}},
 {{- end}}
 {{- range .Imports}}
 {{- range .Info.Funcs}}
 		toplevel.Target{Name: {{lowerFirst .TargetName | printf "%q"}},
 			Fn: {{.FnName}},
 			Synopsis: {{printf "%q" .Synopsis}},
-			Comment: {{printf "%q" .Comment}}},
+			Comment: {{printf "%q" .Comment}},
+			{{- template "args" .Args}}
+			{{- template "aliases" index $.Aliases .}}
+{{- if .Namespace}}
+			Namespace: {{lowerFirst .Namespace | printf "%q"}},
+			NamespaceComment: {{printf "%q" .NamespaceComment}},
+{{- end}}
+			{{- template "import" .Import}}
+			{{- template "directives" .Directives}}},
 {{- end}}
 {{- end}}
 	}
@@ -37,14 +53,18 @@ func main() {
 		toplevel.Target{Name: {{lowerFirst .TargetName | printf "%q"}},
 			Fn: {{.VarName}},
 			Synopsis: {{printf "%q" .Synopsis}},
-			Comment: {{printf "%q" .Comment}}},
+			Comment: {{printf "%q" .Comment}},
+			{{- template "import" .Import}}
+			{{- template "directives" .Directives}}},
 {{- end}}
 {{- range .Imports}}
 {{- range .Info.Vars}}
 		toplevel.Target{Name: {{lowerFirst .TargetName | printf "%q"}},
 			Fn: {{.VarName}},
 			Synopsis: {{printf "%q" .Synopsis}},
-			Comment: {{printf "%q" .Comment}}},
+			Comment: {{printf "%q" .Comment}},
+			{{- template "import" .Import}}
+			{{- template "directives" .Directives}}},
 {{- end}}
 {{- end}}
 	}
@@ -62,4 +82,72 @@ func main() {
 
 
 
+{{define "args"}}
+{{- if .}}
+			Args: []toplevel.Arg{
+{{- range .}}
+				{Name: {{printf "%q" .Name}}, Type: {{printf "%q" .Type}}},
+{{- end}}
+			},
+{{- end}}
+{{- end}}
+
+{{define "import"}}
+{{- if .}}
+			Import: {{printf "%q" .}},
+{{- end}}
+{{- end}}
+
+{{define "directives"}}
+{{- if .Hidden}}
+			Hidden: true,
+{{- end}}
+{{- if .Deprecated}}
+			Deprecated: true,
+			DeprecationNote: {{printf "%q" .DeprecationNote}},
+{{- end}}
+{{- end}}
+
+{{define "aliases"}}
+{{- if .}}
+			Aliases: []string{ {{- range $i, $alias := .}}{{if $i}}, {{end}}{{printf "%q" $alias}}{{end -}} },
+{{- end}}
+{{- end}}
+`
+
+// gamefileTplString is the starting gamefile created by game -init
+var gamefileTplString = `//go:build game
+// +build game
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ridge/game/mg"
+	"github.com/ridge/game/task"
+)
+
+// Default target to run when none is specified.
+// If not set, running game will list available targets.
+var Default = Build
+
+// Build builds the project after installing dependencies.
+func Build(ctx task.Context) {
+	ctx.Dep(Deps.Install)
+	fmt.Println("Building...")
+}
+
+// Deps groups dependency management targets.
+type Deps mg.Namespace
+
+// Install installs dependencies.
+func (Deps) Install(ctx task.Context) {
+	fmt.Println("Installing dependencies...")
+}
+
+// Clean removes build artifacts.
+func Clean(ctx task.Context) {
+	fmt.Println("Cleaning...")
+}
 `
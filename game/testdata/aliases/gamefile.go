@@ -0,0 +1,28 @@
+//+build game
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ridge/game/mg"
+	"github.com/ridge/game/task"
+)
+
+var Aliases = map[string]interface{}{
+	"i":    Install,
+	"inst": Install,
+	"up":   Deploy.Upload,
+}
+
+// Install installs the binary.
+func Install(ctx task.Context) {
+	fmt.Println("installing")
+}
+
+type Deploy mg.Namespace
+
+// Upload uploads the binary.
+func (Deploy) Upload(ctx task.Context) {
+	fmt.Println("uploading")
+}
@@ -0,0 +1,36 @@
+//+build game
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ridge/game/mg"
+	"github.com/ridge/game/task"
+)
+
+// Deploy deploys the given number of replicas to the environment.
+func Deploy(ctx task.Context, env string, replicas int, dryRun bool) {
+	fmt.Printf("deploy %s %d %t\n", env, replicas, dryRun)
+}
+
+// Wait waits for the given duration.
+func Wait(ctx task.Context, d time.Duration, ratio float64) error {
+	if ratio < 0 {
+		return errors.New("negative ratio")
+	}
+	fmt.Printf("wait %s %v\n", d, ratio)
+	return nil
+}
+
+func Status(ctx task.Context) {
+	fmt.Println("status")
+}
+
+type NS mg.Namespace
+
+func (NS) Say(ctx task.Context, msg string) {
+	fmt.Println("say", msg)
+}
@@ -0,0 +1,35 @@
+//+build game
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ridge/game/task"
+)
+
+type generate struct{}
+
+func (generate) Cache() task.CacheSpec {
+	return task.CacheSpec{
+		Inputs:  []string{"gamefile.go"},
+		Env:     []string{"CACHE_TEST_INPUT"},
+		Outputs: []string{filepath.Join(os.Getenv("CACHE_TEST_OUT"), "result.txt")},
+	}
+}
+
+func (generate) Run(ctx task.Context) {
+	input := os.Getenv("CACHE_TEST_INPUT")
+	fmt.Fprintf(ctx.Stdout(), "generating %s\n", input)
+	err := ioutil.WriteFile(filepath.Join(os.Getenv("CACHE_TEST_OUT"), "result.txt"), []byte(input), 0o644)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func Generate(ctx task.Context) {
+	ctx.Dep(generate{})
+}
@@ -0,0 +1,35 @@
+//+build game
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ridge/game/task"
+)
+
+// Build builds everything.
+func Build(ctx task.Context) {
+	ctx.Dep(Generate)
+	fmt.Println("building")
+}
+
+// Generate generates sources for Build.
+//
+//game:hidden
+func Generate(ctx task.Context) {
+	fmt.Println("generating")
+}
+
+// Release builds a release.
+func Release(ctx task.Context) {
+	ctx.Dep(Compile)
+	fmt.Println("releasing")
+}
+
+// Compile is the old name of Build.
+//
+//game:deprecated use build
+func Compile(ctx task.Context) {
+	ctx.Dep(Build)
+}
@@ -0,0 +1,46 @@
+//+build game
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ridge/game/task"
+)
+
+type Compile struct {
+	Pkg string
+}
+
+func (c Compile) Deps() []interface{} {
+	return []interface{}{Generate}
+}
+
+func (c Compile) Run(ctx task.Context) {
+	fmt.Println("compile", c.Pkg)
+}
+
+func (c Compile) String() string {
+	return "compile " + c.Pkg
+}
+
+type Link struct{}
+
+func (Link) Deps() []interface{} {
+	return []interface{}{Compile{"server"}, Compile{"client"}}
+}
+
+func (Link) Run(ctx task.Context) {
+	fmt.Println("link")
+}
+
+func Generate(ctx task.Context) {
+	fmt.Println("generate")
+}
+
+var Build = Link{}
+
+func Release(ctx task.Context) {
+	ctx.Dep(Build)
+	fmt.Println("release")
+}
@@ -0,0 +1,53 @@
+//+build game
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+func Broken(ctx task.Context) {
+	time.Sleep(10 * time.Millisecond)
+	panic(errors.New("compile error"))
+}
+
+func Slow(ctx task.Context) {
+	select {
+	case <-time.After(time.Minute):
+	case <-ctx.Done():
+		panic(ctx.Err())
+	}
+}
+
+func Build(ctx task.Context) {
+	ctx.Dep(Broken, Slow)
+}
+
+func Explicit(ctx task.Context) {
+	ctx.DepFailFast(Broken, Slow)
+}
+
+// Sleeper is busy for a while without checking its context
+type Sleeper struct {
+	N int
+}
+
+func (s Sleeper) Run(ctx task.Context) {
+	time.Sleep(200 * time.Millisecond)
+}
+
+func (s Sleeper) String() string {
+	return fmt.Sprintf("Sleeper%d", s.N)
+}
+
+func Limited(ctx task.Context) {
+	ctx.Dep(Broken, Sleeper{1}, Sleeper{2}, Sleeper{3}, Sleeper{4})
+}
+
+func Sequential(ctx task.Context) {
+	ctx.SeqDep(Broken, Sleeper{5})
+}
@@ -0,0 +1,27 @@
+//+build game
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+func First(ctx task.Context) {
+	fmt.Fprintln(ctx.Stdout(), "first 1")
+	time.Sleep(200 * time.Millisecond)
+	fmt.Fprintln(ctx.Stdout(), "first 2")
+}
+
+func Second(ctx task.Context) {
+	time.Sleep(100 * time.Millisecond)
+	fmt.Fprintln(ctx.Stdout(), "second 1")
+	time.Sleep(200 * time.Millisecond)
+	fmt.Fprintln(ctx.Stdout(), "second 2")
+}
+
+func Build(ctx task.Context) {
+	ctx.Dep(First, Second)
+}
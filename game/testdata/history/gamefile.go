@@ -0,0 +1,14 @@
+//+build game
+
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// Sleeps for the duration given by $SLEEP
+func Sleep() {
+	d, _ := time.ParseDuration(os.Getenv("SLEEP"))
+	time.Sleep(d)
+}
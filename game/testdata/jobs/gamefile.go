@@ -0,0 +1,50 @@
+//+build game
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+var (
+	mu      sync.Mutex
+	running int
+	peak    int
+)
+
+type Leaf struct {
+	i int
+}
+
+func (l Leaf) Run(ctx task.Context) {
+	mu.Lock()
+	running++
+	if running > peak {
+		peak = running
+	}
+	mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	mu.Lock()
+	running--
+	mu.Unlock()
+}
+
+type Branch struct {
+	i int
+}
+
+func (b Branch) Run(ctx task.Context) {
+	ctx.Dep(Leaf{b.i * 10}, Leaf{b.i*10 + 1}, Leaf{b.i*10 + 2})
+}
+
+func Fanout(ctx task.Context) {
+	ctx.Dep(Branch{1}, Branch{2}, Branch{3}, Branch{4})
+	ctx.SeqDep(Branch{5}, Branch{6})
+	fmt.Printf("peak %d\n", peak)
+}
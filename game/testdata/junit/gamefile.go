@@ -0,0 +1,23 @@
+//+build game
+
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ridge/game/task"
+)
+
+func Compile(ctx task.Context) {
+	fmt.Fprintln(ctx.Stdout(), "compiling")
+}
+
+func Lint(ctx task.Context) {
+	fmt.Fprintln(ctx.Stderr(), "main.go:1: bad style")
+	panic(errors.New("lint failed"))
+}
+
+func Build(ctx task.Context) {
+	ctx.Dep(Compile, Lint)
+}
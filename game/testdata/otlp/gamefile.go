@@ -0,0 +1,28 @@
+//+build game
+
+package main
+
+import (
+	"errors"
+
+	"github.com/ridge/game/sh"
+	"github.com/ridge/game/task"
+)
+
+func Generate(ctx task.Context) {
+	if err := sh.Run(ctx, "sh", "-c", `echo "traceparent=$TRACEPARENT"`); err != nil {
+		panic(err)
+	}
+}
+
+func Check(ctx task.Context) {
+	ctx.Dep(Generate)
+}
+
+func Build(ctx task.Context) {
+	ctx.Dep(Generate, Check)
+}
+
+func Fail(ctx task.Context) {
+	panic(errors.New("boom"))
+}
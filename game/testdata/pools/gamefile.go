@@ -0,0 +1,51 @@
+//+build game
+
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+var database = task.NewPool("database", 1)
+
+var (
+	mu    sync.Mutex
+	users int
+	peak  int
+)
+
+type Query struct {
+	i int
+}
+
+func (q Query) Run(ctx task.Context) {
+	ctx.Acquire(database)
+
+	mu.Lock()
+	users++
+	if users > peak {
+		peak = users
+	}
+	mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	mu.Lock()
+	users--
+	mu.Unlock()
+}
+
+// Migrate holds the database and then runs queries, which need it too
+func Migrate(ctx task.Context) {
+	ctx.Acquire(database)
+	ctx.Dep(Query{0})
+}
+
+func Queries(ctx task.Context) {
+	ctx.Dep(Migrate, Query{1}, Query{2}, Query{3}, Query{4})
+	fmt.Printf("peak %d\n", peak)
+}
@@ -0,0 +1,53 @@
+//+build game
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+var errFatal = errors.New("fatal")
+
+type Flaky struct {
+	failures int
+	err      error
+	attempts *int
+}
+
+func (f Flaky) RetryPolicy() task.RetryPolicy {
+	return task.RetryPolicy{
+		Attempts: 3,
+		Backoff:  time.Millisecond,
+		Retryable: func(err error) bool {
+			return err != errFatal
+		},
+	}
+}
+
+func (f Flaky) Run(ctx task.Context) {
+	*f.attempts++
+	fmt.Fprintf(ctx.Stdout(), "attempt %d\n", *f.attempts)
+	if *f.attempts <= f.failures {
+		panic(f.err)
+	}
+}
+
+func (f Flaky) Identify() interface{} {
+	return fmt.Sprintf("flaky %d %v", f.failures, f.err)
+}
+
+func Recovers(ctx task.Context) {
+	ctx.Dep(Flaky{failures: 2, err: errors.New("flaky"), attempts: new(int)})
+}
+
+func GivesUp(ctx task.Context) {
+	ctx.Dep(Flaky{failures: 5, err: errors.New("flaky"), attempts: new(int)})
+}
+
+func Fatal(ctx task.Context) {
+	ctx.Dep(Flaky{failures: 5, err: errFatal, attempts: new(int)})
+}
@@ -0,0 +1,36 @@
+//+build game
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ridge/game/sh"
+	"github.com/ridge/game/task"
+)
+
+func Streams(ctx task.Context) {
+	if err := sh.Run(ctx, "sh", "-c", "echo out; echo err >&2"); err != nil {
+		panic(err)
+	}
+}
+
+func Output(ctx task.Context) {
+	out, err := sh.Output(ctx, "echo", "hello")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(ctx.Stdout(), "got %q\n", out)
+}
+
+func Fail(ctx task.Context) {
+	err := sh.RunWith(ctx, map[string]string{"CODE": "3"}, "sh", "-c", "exit $CODE")
+	fmt.Fprintf(ctx.Stdout(), "exit status %d\n", sh.ExitStatus(err))
+	panic(err)
+}
+
+func Hang(ctx task.Context) {
+	if err := sh.Run(ctx, "sh", "-c", "sleep 10 & wait"); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,28 @@
+//+build game
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/ridge/game/mg"
+	"github.com/ridge/game/task"
+)
+
+func Build(ctx task.Context) {
+	fmt.Println("building")
+}
+
+type Deploy mg.Namespace
+
+func (Deploy) Clean(ctx task.Context) {
+	fmt.Println("cleaning")
+}
+
+func (Deploy) Update(ctx task.Context) {
+	fmt.Println("updating")
+}
+
+func (Deploy) Upload(ctx task.Context) {
+	fmt.Println("uploading")
+}
@@ -0,0 +1,26 @@
+//+build game
+
+package main
+
+import (
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+func Generate(ctx task.Context) {
+	time.Sleep(100 * time.Millisecond)
+}
+
+func Slow(ctx task.Context) {
+	ctx.Dep(Generate)
+	time.Sleep(200 * time.Millisecond)
+}
+
+func Fast(ctx task.Context) {
+	time.Sleep(10 * time.Millisecond)
+}
+
+func Build(ctx task.Context) {
+	ctx.Dep(Fast, Slow)
+}
@@ -0,0 +1,29 @@
+//+build game
+
+package main
+
+import (
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+type Fetch struct{}
+
+func (Fetch) Timeout() time.Duration {
+	return 50 * time.Millisecond
+}
+
+func (Fetch) Run(ctx task.Context) {
+	ctx.Dep(Download)
+}
+
+func Download(ctx task.Context) {
+	select {
+	case <-time.After(5 * time.Second):
+	case <-ctx.Done():
+		panic(ctx.Err())
+	}
+}
+
+var Update = Fetch{}
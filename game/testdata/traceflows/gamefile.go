@@ -0,0 +1,27 @@
+//+build game
+
+package main
+
+import (
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+func Generate(ctx task.Context) {
+	time.Sleep(200 * time.Millisecond)
+}
+
+func Compile(ctx task.Context) {
+	ctx.Dep(Generate)
+}
+
+// Lint depends on Generate after Compile has started it
+func Lint(ctx task.Context) {
+	time.Sleep(100 * time.Millisecond)
+	ctx.Dep(Generate)
+}
+
+func Build(ctx task.Context) {
+	ctx.Dep(Compile, Lint)
+}
@@ -0,0 +1,20 @@
+//+build game
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ridge/game/target"
+	"github.com/ridge/game/task"
+)
+
+func Build(ctx task.Context) {
+	target.SkipPath(ctx, "$UPTODATE_DIR/out", "$UPTODATE_DIR/src")
+	fmt.Fprintln(ctx.Stdout(), "building")
+	if err := ioutil.WriteFile(os.ExpandEnv("$UPTODATE_DIR/out"), nil, 0o644); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,69 @@
+//+build game
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+// countRun returns the number of the runs so far, including this one
+func countRun(ctx task.Context) int {
+	ctx.Watch(os.Getenv("WATCH_DIR"))
+
+	state := filepath.Join(os.Getenv("WATCH_STATE"), "runs")
+	data, _ := ioutil.ReadFile(state)
+	runs := len(data) + 1
+	if err := ioutil.WriteFile(state, []byte(strings.Repeat("x", runs)), 0o644); err != nil {
+		panic(err)
+	}
+	return runs
+}
+
+// Build exits after the second run
+func Build(ctx task.Context) {
+	runs := countRun(ctx)
+	fmt.Fprintf(ctx.Stdout(), "run %d\n", runs)
+	if runs == 2 {
+		os.Exit(0)
+	}
+}
+
+// Slow waits to be cancelled on the second run and exits after the third one
+func Slow(ctx task.Context) {
+	runs := countRun(ctx)
+	fmt.Fprintf(ctx.Stdout(), "run %d\n", runs)
+	switch runs {
+	case 2:
+		<-ctx.Done()
+		fmt.Fprintf(ctx.Stdout(), "run %d cancelled\n", runs)
+		panic(ctx.Err())
+	case 3:
+		os.Exit(0)
+	}
+}
+
+// Generate writes under the directory it watches, and exits after the third run
+func Generate(ctx task.Context) {
+	runs := countRun(ctx)
+	out := filepath.Join(os.Getenv("WATCH_DIR"), "out")
+	ctx.Produces(out)
+	if err := ioutil.WriteFile(out, []byte(fmt.Sprint(runs)), 0o644); err != nil {
+		panic(err)
+	}
+	select {
+	case <-time.After(time.Second):
+	case <-ctx.Done():
+		panic(ctx.Err())
+	}
+	fmt.Fprintf(ctx.Stdout(), "run %d\n", runs)
+	if runs == 3 {
+		os.Exit(0)
+	}
+}
@@ -39,6 +39,84 @@ const HashFastEnv = "GAMEFILE_HASHFAST"
 // NoTTYEnv disables TTY console reporter
 const NoTTYEnv = "GAMEFILE_NO_TTY"
 
+// JobsEnv is the environment variable that limits the number of tasks
+// computing simultaneously.
+const JobsEnv = "GAMEFILE_JOBS"
+
+// FailFastEnv is the environment variable that indicates the user requested
+// to cancel remaining tasks as soon as one of them fails.
+const FailFastEnv = "GAMEFILE_FAIL_FAST"
+
+// EventsEnv is the environment variable that sets the destination of the
+// machine-readable task event stream: either a file path or "fd:N".
+const EventsEnv = "GAMEFILE_EVENTS"
+
+// JUnitEnv is the environment variable that sets the file to save results of
+// tasks to in JUnit XML format.
+const JUnitEnv = "GAMEFILE_JUNIT"
+
+// SummaryEnv is the environment variable that indicates the user requested
+// a summary of where the time went after running the targets.
+const SummaryEnv = "GAMEFILE_SUMMARY"
+
+// GroupedOutputEnv is the environment variable that indicates the user
+// requested the output of each task to be printed as a block once the task
+// finishes.
+const GroupedOutputEnv = "GAMEFILE_GROUPED_OUTPUT"
+
+// HistoryEnv is the environment variable that names the task to print the
+// timings of the recent runs of instead of running targets.
+const HistoryEnv = "GAMEFILE_HISTORY"
+
+// OTLPEndpointEnv is the standard OpenTelemetry environment variable that sets
+// the base URL of the collector to export spans of tasks to over OTLP/HTTP.
+// Spans are sent to its /v1/traces path.
+const OTLPEndpointEnv = "OTEL_EXPORTER_OTLP_ENDPOINT"
+
+// OTLPTracesEndpointEnv is the standard OpenTelemetry environment variable
+// that sets the full URL to export spans of tasks to over OTLP/HTTP. It takes
+// precedence over OTLPEndpointEnv.
+const OTLPTracesEndpointEnv = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+
+// TraceParentEnv is the environment variable carrying the W3C trace context
+// of the parent span. Runs of targets join the trace given by it and pass it on
+// to the commands run by the tasks.
+const TraceParentEnv = "TRACEPARENT"
+
+// DryRunEnv is the environment variable that indicates the user requested to
+// print the graph of tasks instead of running them.
+const DryRunEnv = "GAMEFILE_DRY_RUN"
+
+// WatchEnv is the environment variable that indicates the user requested to
+// run the targets again when files they depend on change.
+const WatchEnv = "GAMEFILE_WATCH"
+
+// WatchFilesEnv is the environment variable that lists additional files to
+// watch in watch mode, separated by os.PathListSeparator. The gamefile binary
+// exits with WatchRebuildExitCode once any of them change.
+const WatchFilesEnv = "GAMEFILE_WATCH_FILES"
+
+// WatchRebuildExitCode is the exit code of a gamefile binary in watch mode
+// telling game that gamefiles have changed, so the binary has to be rebuilt and
+// run again.
+const WatchRebuildExitCode = 3
+
+// CompleteTargetsEnv is the environment variable that indicates the user
+// requested the names of targets for shell completion.
+const CompleteTargetsEnv = "GAMEFILE_COMPLETE_TARGETS"
+
+// ListAllEnv is the environment variable that indicates the user requested to
+// list hidden targets too.
+const ListAllEnv = "GAMEFILE_LIST_ALL"
+
+// ListFormatEnv is the environment variable that sets the format of the list
+// of targets: "text" or "json".
+const ListFormatEnv = "GAMEFILE_LIST_FORMAT"
+
+// PrefixEnv is the environment variable that indicates the user requested to
+// run targets given by unambiguous prefixes of their names.
+const PrefixEnv = "GAMEFILE_PREFIX"
+
 // Verbose reports whether a gamefile was run with the verbose flag.
 func Verbose() bool {
 	b, _ := strconv.ParseBool(os.Getenv(VerboseEnv))
@@ -74,6 +152,14 @@ func IgnoreDefault() bool {
 	return b
 }
 
+// TasksCacheDir is the subdirectory of CacheDir where results of cacheable
+// tasks are stored.
+const TasksCacheDir = "tasks"
+
+// HistoryCacheDir is the subdirectory of CacheDir where timings of tasks are
+// recorded.
+const HistoryCacheDir = "history"
+
 // CacheDir returns the directory where game caches compiled binaries.  It
 // defaults to $HOME/.gamefile, but may be overridden by the GAMEFILE_CACHE
 // environment variable.
@@ -16,7 +16,11 @@ import (
 	"github.com/ridge/game/internal"
 )
 
-const importTag = "game:import"
+const (
+	importTag     = "game:import"
+	hiddenTag     = "game:hidden"
+	deprecatedTag = "game:deprecated"
+)
 
 var debug = log.New(ioutil.Discard, "DEBUG: ", log.Ltime|log.Lmicroseconds)
 
@@ -25,10 +29,18 @@ func EnableDebug() {
 	debug.SetOutput(os.Stderr)
 }
 
+// Directives are set by //game: directives in the doc comment of a target
+type Directives struct {
+	Hidden          bool   // //game:hidden omits the target from the list of targets
+	Deprecated      bool   // //game:deprecated [note] warns when the target is run
+	DeprecationNote string // the text following //game:deprecated, e.g. "use build:all"
+}
+
 // Var contains information about a variable
 type Var struct {
 	Comment  string
 	Synopsis string
+	Directives
 
 	name       string
 	pkg        string
@@ -49,6 +61,12 @@ func (v Var) TargetName() string {
 	}
 }
 
+// Import returns the alias of the package the variable is imported from, if
+// any.
+func (v Var) Import() string {
+	return v.pkgAlias
+}
+
 // VarName returns the var name in Go syntax
 func (v Var) VarName() string {
 	name := v.name
@@ -62,6 +80,7 @@ func (v Var) VarName() string {
 type PrimaryPkgInfo struct {
 	*PkgInfo
 	DefaultFunc    *Function
+	Aliases        map[string]*Function
 	HasUsageConfig bool
 	Imports        []*Import
 }
@@ -74,18 +93,27 @@ type PkgInfo struct {
 	Vars        []*Var
 }
 
+// Arg is a typed command-line argument of a target function
+type Arg struct {
+	Name string
+	Type string
+}
+
 // Function represented a job function from a game file
 type Function struct {
 	Synopsis string
 	Comment  string
+	Args     []Arg
+	Directives
 
-	name       string
-	receiver   string
-	pkgAlias   string
-	pkg        string
-	importPath string
-	isError    bool
-	isContext  bool
+	name            string
+	receiver        string
+	receiverComment string
+	pkgAlias        string
+	pkg             string
+	importPath      string
+	isError         bool
+	isContext       bool
 }
 
 // ID returns user-readable information about where this function is defined.
@@ -117,6 +145,22 @@ func (f Function) TargetName() string {
 	return strings.Join(names, ":")
 }
 
+// Namespace returns the namespace of the function, if any.
+func (f Function) Namespace() string {
+	return f.receiver
+}
+
+// NamespaceComment returns the doc comment of the namespace of the function.
+func (f Function) NamespaceComment() string {
+	return f.receiverComment
+}
+
+// Import returns the alias of the package the function is imported from, if
+// any.
+func (f Function) Import() string {
+	return f.pkgAlias
+}
+
 // FnName returns the function name in Go syntax
 func (f Function) FnName() string {
 	name := f.name
@@ -145,6 +189,7 @@ func PrimaryPackage(gocmd, path string, files []string) (*PrimaryPkgInfo, error)
 		PkgInfo:        info,
 		Imports:        imports,
 		DefaultFunc:    getDefault(info.Funcs, imports, docPkg),
+		Aliases:        getAliases(info.Funcs, imports, docPkg),
 		HasUsageConfig: getUsageConfig(docPkg),
 	}, nil
 }
@@ -191,7 +236,8 @@ func Package(path string, files []string) (*PkgInfo, *ast.Package, *doc.Package,
 	if err != nil {
 		return nil, nil, nil, err
 	}
-	p := doc.New(pkg, "./", 0)
+	// preserve doc comments in the AST, directives are read from there
+	p := doc.New(pkg, "./", doc.PreserveAST)
 	pi := &PkgInfo{
 		Description: p.Doc,
 	}
@@ -270,9 +316,10 @@ func getVars(docPkg *doc.Package) []*Var {
 				continue
 			}
 			output = append(output, &Var{
-				name:     name,
-				Comment:  toOneLine(v.Doc),
-				Synopsis: sanitizeSynopsis(v.Doc, name),
+				name:       name,
+				Comment:    toOneLine(v.Doc),
+				Synopsis:   sanitizeSynopsis(v.Doc, name),
+				Directives: getDirectives(v.Decl.Doc),
 			})
 		}
 	}
@@ -292,14 +339,16 @@ func getFuncs(docPkg *doc.Package) []*Function {
 			// skip non-exported functions
 			continue
 		}
-		if typ := funcType(f.Decl.Type); typ != invalidType {
+		if typ, args := funcType(f.Decl.Type); typ != invalidType {
 			debug.Printf("found target %v", f.Name)
 			output = append(output, &Function{
-				name:      f.Name,
-				Comment:   toOneLine(f.Doc),
-				Synopsis:  sanitizeSynopsis(f.Doc, f.Name),
-				isError:   typ == errorType || typ == contextErrorType,
-				isContext: typ == contextVoidType || typ == contextErrorType,
+				name:       f.Name,
+				Comment:    toOneLine(f.Doc),
+				Synopsis:   sanitizeSynopsis(f.Doc, f.Name),
+				Args:       args,
+				Directives: getDirectives(f.Decl.Doc),
+				isError:    typ == errorType || typ == contextErrorType,
+				isContext:  typ == contextVoidType || typ == contextErrorType,
 			})
 		} else {
 			debug.Printf("skipping function with invalid signature func %s(%v)(%v)", f.Name, fieldNames(f.Decl.Type.Params), fieldNames(f.Decl.Type.Results))
@@ -319,24 +368,50 @@ func getNamespacedFuncs(docPkg *doc.Package) []*Function {
 			if !ast.IsExported(f.Name) {
 				continue
 			}
-			typ := funcType(f.Decl.Type)
+			typ, args := funcType(f.Decl.Type)
 			if typ == invalidType {
 				continue
 			}
 			debug.Printf("found namespace method %s %s.%s", docPkg.ImportPath, t.Name, f.Name)
 			output = append(output, &Function{
-				name:      f.Name,
-				receiver:  t.Name,
-				Comment:   toOneLine(f.Doc),
-				Synopsis:  sanitizeSynopsis(f.Doc, f.Name),
-				isError:   typ == errorType || typ == contextErrorType,
-				isContext: typ == contextVoidType || typ == contextErrorType,
+				name:            f.Name,
+				receiver:        t.Name,
+				receiverComment: toOneLine(t.Doc),
+				Comment:         toOneLine(f.Doc),
+				Synopsis:        sanitizeSynopsis(f.Doc, f.Name),
+				Args:            args,
+				Directives:      getDirectives(f.Decl.Doc),
+				isError:         typ == errorType || typ == contextErrorType,
+				isContext:       typ == contextVoidType || typ == contextErrorType,
 			})
 		}
 	}
 	return output
 }
 
+// getDirectives collects //game: directives from the doc comment. Like other
+// directives, they are left out of the text of the comment.
+func getDirectives(doc *ast.CommentGroup) Directives {
+	var d Directives
+	if doc == nil {
+		return d
+	}
+	for _, c := range doc.List {
+		tag, note := c.Text, ""
+		if i := strings.IndexAny(tag, " \t"); i >= 0 {
+			tag, note = tag[:i], strings.TrimSpace(tag[i:])
+		}
+		switch tag {
+		case "//" + hiddenTag:
+			d.Hidden = true
+		case "//" + deprecatedTag:
+			d.Deprecated = true
+			d.DeprecationNote = note
+		}
+	}
+	return d
+}
+
 func getImports(gocmd string, funcs []*Function, vars []*Var, astPkg *ast.Package) ([]*Import, error) {
 	importNames := map[string]string{}
 	rootImports := []string{}
@@ -548,6 +623,67 @@ func getDefault(funcs []*Function, imports []*Import, docPkg *doc.Package) *Func
 	return nil
 }
 
+func getAliases(funcs []*Function, imports []*Import, docPkg *doc.Package) map[string]*Function {
+	for _, v := range docPkg.Vars {
+		for x, name := range v.Names {
+			if name != "Aliases" {
+				continue
+			}
+			spec := v.Decl.Specs[x].(*ast.ValueSpec)
+			if len(spec.Values) != 1 {
+				log.Println("warning: aliases declaration has multiple values")
+				return nil
+			}
+			comp, ok := spec.Values[0].(*ast.CompositeLit)
+			if !ok {
+				log.Println("warning: aliases declaration is not a map")
+				return nil
+			}
+
+			targets := map[string]bool{}
+			for _, f := range funcs {
+				targets[strings.ToLower(f.TargetName())] = true
+			}
+			for _, imp := range imports {
+				for _, f := range imp.Info.Funcs {
+					targets[strings.ToLower(f.TargetName())] = true
+				}
+			}
+
+			aliases := map[string]*Function{}
+			for _, elt := range comp.Elts {
+				kv, ok := elt.(*ast.KeyValueExpr)
+				if !ok {
+					log.Printf("warning: alias declaration %q is not a map element", elt)
+					continue
+				}
+				lit, ok := kv.Key.(*ast.BasicLit)
+				if !ok {
+					log.Printf("warning: alias %q is not a string literal", kv.Key)
+					continue
+				}
+				alias, ok := lit2string(lit)
+				if !ok {
+					log.Printf("warning: alias %s is not a string literal", lit.Value)
+					continue
+				}
+				if targets[strings.ToLower(alias)] {
+					log.Printf("warning: alias %q conflicts with a target of the same name", alias)
+					continue
+				}
+				f, err := getFunction(kv.Value, funcs, imports)
+				if err != nil {
+					log.Printf("warning, alias %q declaration malformed: %v", alias, err)
+					continue
+				}
+				aliases[alias] = f
+			}
+			return aliases
+		}
+	}
+	return nil
+}
+
 func getUsageConfig(docPkg *doc.Package) bool {
 	for _, v := range docPkg.Vars {
 		for _, name := range v.Names {
@@ -684,7 +820,7 @@ func getPackage(path string, files []string, fset *token.FileSet) (*ast.Package,
 }
 
 func hasContextParam(ft *ast.FuncType) bool {
-	if ft.Params.NumFields() != 1 {
+	if ft.Params.NumFields() < 1 || len(ft.Params.List[0].Names) > 1 {
 		return false
 	}
 	ret := ft.Params.List[0]
@@ -730,24 +866,68 @@ const (
 	contextErrorType
 )
 
-func funcType(ft *ast.FuncType) functype {
+// argTypes maps supported types of target arguments to their names
+var argTypes = map[string]string{
+	"string":        "string",
+	"int":           "int",
+	"bool":          "bool",
+	"float64":       "float64",
+	"time.Duration": "time.Duration",
+}
+
+func typeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.SelectorExpr:
+		if pkg, ok := t.X.(*ast.Ident); ok {
+			return pkg.Name + "." + t.Sel.Name
+		}
+	}
+	return fmt.Sprint(expr)
+}
+
+// funcArgs returns typed command-line arguments of a function: all parameters
+// following the context one
+func funcArgs(ft *ast.FuncType) ([]Arg, bool) {
+	var args []Arg
+	for _, field := range ft.Params.List[1:] {
+		typ, ok := argTypes[typeName(field.Type)]
+		if !ok {
+			return nil, false
+		}
+		if len(field.Names) == 0 {
+			args = append(args, Arg{Name: fmt.Sprintf("arg%d", len(args)+1), Type: typ})
+		}
+		for _, name := range field.Names {
+			args = append(args, Arg{Name: name.Name, Type: typ})
+		}
+	}
+	return args, true
+}
+
+func funcType(ft *ast.FuncType) (functype, []Arg) {
 	if hasContextParam(ft) {
+		args, ok := funcArgs(ft)
+		if !ok {
+			return invalidType, nil
+		}
 		if hasVoidReturn(ft) {
-			return contextVoidType
+			return contextVoidType, args
 		}
 		if hasErrorReturn(ft) {
-			return contextErrorType
+			return contextErrorType, args
 		}
 	}
 	if ft.Params.NumFields() == 0 {
 		if hasVoidReturn(ft) {
-			return voidType
+			return voidType, nil
 		}
 		if hasErrorReturn(ft) {
-			return errorType
+			return errorType, nil
 		}
 	}
-	return invalidType
+	return invalidType, nil
 }
 
 func toOneLine(s string) string {
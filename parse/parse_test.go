@@ -37,6 +37,28 @@ func TestParse(t *testing.T) {
 			Comment:  "RepeatingSynopsis chops off the repeating function name. Some more text.",
 			Synopsis: "chops off the repeating function name.",
 		},
+		{
+			name:      "TakesArgs",
+			isContext: true,
+			Args: []Arg{
+				{Name: "name", Type: "string"},
+				{Name: "count", Type: "int"},
+				{Name: "force", Type: "bool"},
+			},
+		},
+		{
+			name:       "Helper",
+			Comment:    "Helper is only run as a dependency.",
+			Synopsis:   "is only run as a dependency.",
+			Directives: Directives{Hidden: true},
+		},
+		{
+			name:       "Old",
+			receiver:   "Build",
+			Comment:    "Old builds the old way.",
+			Synopsis:   "builds the old way.",
+			Directives: Directives{Deprecated: true, DeprecationNote: "use build:foobar"},
+		},
 		{
 			name:     "Foobar",
 			receiver: "Build",
@@ -63,6 +85,16 @@ func TestParse(t *testing.T) {
 		t.Fatalf("expected DefaultName to be ReturnsNilError")
 	}
 
+	if len(info.Aliases) != 2 {
+		t.Fatalf("expected 2 aliases, but got %v", info.Aliases)
+	}
+	if f := info.Aliases["void"]; f == nil || f.name != "ReturnsVoid" {
+		t.Fatalf("expected alias void to be ReturnsVoid, but got %#v", f)
+	}
+	if f := info.Aliases["baz"]; f == nil || f.TargetName() != "Build:Baz" {
+		t.Fatalf("expected alias baz to be Build:Baz, but got %#v", f)
+	}
+
 	for _, fn := range expected {
 		found := false
 		for _, infoFn := range info.Funcs {
@@ -78,6 +110,12 @@ func TestParse(t *testing.T) {
 		}
 	}
 
+	for _, infoFn := range info.Funcs {
+		if infoFn.name == "TakesInvalidArgs" {
+			t.Fatalf("expected function with unsupported argument types to be skipped")
+		}
+	}
+
 	expectedVars := []Var{
 		{
 			name: "VarWrongType",
@@ -13,6 +13,12 @@ import (
 // This should work as a default - even if it's in a different file
 var Default = ReturnsNilError
 
+var Aliases = map[string]interface{}{
+	"void":  ReturnsVoid,
+	"baz":   Build.Baz,
+	"dummy": NoSuchTarget,
+}
+
 // this should not be a target because it returns a string
 func ReturnsString() string {
 	fmt.Println("more stuff")
@@ -46,3 +52,9 @@ var VarWrongType = 42
 var VarNoInterface = struct{}{}
 
 var VarTarget = Ru{}
+
+func TakesArgs(ctx context.Context, name string, count int, force bool) {
+}
+
+func TakesInvalidArgs(ctx context.Context, names []string) {
+}
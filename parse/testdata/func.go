@@ -12,3 +12,8 @@ func ReturnsNilError() error {
 }
 
 func nonexported() {}
+
+// Helper is only run as a dependency.
+//
+//game:hidden
+func Helper() {}
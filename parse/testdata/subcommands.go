@@ -21,3 +21,7 @@ func (Init) Foobar() error {
 	// do your foobar defined in init namespace
 	return nil
 }
+
+// Old builds the old way.
+//game:deprecated use build:foobar
+func (Build) Old() {}
@@ -0,0 +1,14 @@
+//go:build !(aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris)
+
+package sh
+
+import (
+	"os/exec"
+)
+
+func setProcessGroup(c *exec.Cmd) {
+}
+
+func killProcessGroup(c *exec.Cmd) {
+	c.Process.Kill()
+}
@@ -0,0 +1,136 @@
+// Package sh runs external commands from tasks. Output of the commands goes to
+// the output streams of the current task, and the commands are killed together
+// with their child processes once the context of the task is cancelled.
+package sh
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/ridge/game/mg"
+	"github.com/ridge/game/task"
+)
+
+// ExitError is an error of a command that failed
+type ExitError struct {
+	Cmd  string // command line
+	Code int    // exit code, or -1 if the command has not exited on its own
+	Err  error  // the underlying error
+}
+
+func (ee *ExitError) Error() string {
+	if ee.Code >= 0 {
+		return fmt.Sprintf("running %s failed with exit code %d", ee.Cmd, ee.Code)
+	}
+	return fmt.Sprintf("running %s failed: %v", ee.Cmd, ee.Err)
+}
+
+func (ee *ExitError) Unwrap() error {
+	return ee.Err
+}
+
+// ExitStatus returns the exit code of the command that failed with the error:
+// 0 if err is nil, and 1 if the exit code is unknown.
+func ExitStatus(err error) int {
+	switch err := err.(type) {
+	case nil:
+		return 0
+	case *ExitError:
+		if err.Code >= 0 {
+			return err.Code
+		}
+	}
+	return 1
+}
+
+// Run runs the command, sending its output to the output of the task
+func Run(ctx task.Context, cmd string, args ...string) error {
+	return RunWith(ctx, nil, cmd, args...)
+}
+
+// RunWith is like Run, but adds the given variables to the environment of the
+// command
+func RunWith(ctx task.Context, env map[string]string, cmd string, args ...string) error {
+	return Exec(ctx, env, ctx.Stdout(), ctx.Stderr(), cmd, args...)
+}
+
+// Output runs the command and returns its stdout without the trailing newline.
+// Stderr of the command goes to the output of the task.
+func Output(ctx task.Context, cmd string, args ...string) (string, error) {
+	return OutputWith(ctx, nil, cmd, args...)
+}
+
+// OutputWith is like Output, but adds the given variables to the environment
+// of the command
+func OutputWith(ctx task.Context, env map[string]string, cmd string, args ...string) (string, error) {
+	buf := &bytes.Buffer{}
+	err := Exec(ctx, env, buf, ctx.Stderr(), cmd, args...)
+	return strings.TrimSuffix(buf.String(), "\n"), err
+}
+
+// Exec runs the command with the given variables added to its environment,
+// sending its output to the given writers. The command line is echoed to the
+// output of the task in verbose mode.
+func Exec(ctx task.Context, env map[string]string, stdout, stderr io.Writer, cmd string, args ...string) error {
+	line := cmdLine(cmd, args)
+	if mg.Verbose() {
+		fmt.Fprintf(ctx.Stdout(), "exec: %s\n", line)
+	}
+
+	c := exec.Command(cmd, args...)
+	c.Env = ctx.Environ()
+	for k, v := range env {
+		c.Env = append(c.Env, k+"="+v)
+	}
+	c.Stdin = os.Stdin
+	c.Stdout = stdout
+	c.Stderr = stderr
+	setProcessGroup(c)
+
+	if err := c.Start(); err != nil {
+		return &ExitError{Cmd: line, Code: -1, Err: err}
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			killProcessGroup(c)
+		case <-done:
+		}
+	}()
+
+	err := c.Wait()
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return &ExitError{Cmd: line, Code: -1, Err: ctx.Err()}
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.Exited() {
+		return &ExitError{Cmd: line, Code: exitErr.ExitCode(), Err: err}
+	}
+	return &ExitError{Cmd: line, Code: -1, Err: err}
+}
+
+// cmdLine formats the command line, quoting arguments where needed
+func cmdLine(cmd string, args []string) string {
+	s := []string{quote(cmd)}
+	for _, arg := range args {
+		s = append(s, quote(arg))
+	}
+	return strings.Join(s, " ")
+}
+
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\n'\"\\$`;&|<>()*?[]#~{}!") {
+		return strconv.Quote(s)
+	}
+	return s
+}
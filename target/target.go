@@ -0,0 +1,166 @@
+// Package target compares modification times of files to tell whether a
+// destination needs to be rebuilt from its sources.
+//
+// All paths are expanded with os.ExpandEnv.
+package target
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+// Path reports whether any of the sources have been modified more recently
+// than the destination, or the destination does not exist. Directories are not
+// walked: only the modification time of a directory itself is compared.
+func Path(dst string, sources ...string) (bool, error) {
+	stat, err := os.Stat(os.ExpandEnv(dst))
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return newerThan(stat.ModTime(), expand(sources), false)
+}
+
+// Glob is like Path, but sources are filepath.Glob patterns. Patterns without
+// matches are ignored.
+func Glob(dst string, globs ...string) (bool, error) {
+	var sources []string
+	for _, g := range expand(globs) {
+		matches, err := filepath.Glob(g)
+		if err != nil {
+			return false, err
+		}
+		sources = append(sources, matches...)
+	}
+	return Path(dst, sources...)
+}
+
+// Dir is like Path, but directories are walked recursively, and the newest
+// modification time of files and directories under them is compared.
+func Dir(dst string, sources ...string) (bool, error) {
+	dst = os.ExpandEnv(dst)
+	if _, err := os.Stat(dst); os.IsNotExist(err) {
+		return true, nil
+	}
+	dstTime, err := NewestModTime(dst)
+	if err != nil {
+		return false, err
+	}
+	return newerThan(dstTime, expand(sources), true)
+}
+
+// NewestModTime returns the newest modification time of the given paths,
+// walking directories recursively
+func NewestModTime(paths ...string) (time.Time, error) {
+	var newest time.Time
+	err := walk(expand(paths), func(info os.FileInfo) bool {
+		if info.ModTime().After(newest) {
+			newest = info.ModTime()
+		}
+		return false
+	})
+	return newest, err
+}
+
+// OldestModTime returns the oldest modification time of the given paths,
+// walking directories recursively
+func OldestModTime(paths ...string) (time.Time, error) {
+	var oldest time.Time
+	err := walk(expand(paths), func(info os.FileInfo) bool {
+		if oldest.IsZero() || info.ModTime().Before(oldest) {
+			oldest = info.ModTime()
+		}
+		return false
+	})
+	return oldest, err
+}
+
+// SkipPath stops the task, reporting it as up to date, unless Path reports
+// that the destination needs to be rebuilt. It panics if the check fails.
+func SkipPath(ctx task.Context, dst string, sources ...string) {
+	changed, err := Path(dst, sources...)
+	skipUnless(ctx, changed, err)
+}
+
+// SkipGlob is like SkipPath, but uses Glob for the check
+func SkipGlob(ctx task.Context, dst string, globs ...string) {
+	changed, err := Glob(dst, globs...)
+	skipUnless(ctx, changed, err)
+}
+
+// SkipDir is like SkipPath, but uses Dir for the check
+func SkipDir(ctx task.Context, dst string, sources ...string) {
+	changed, err := Dir(dst, sources...)
+	skipUnless(ctx, changed, err)
+}
+
+func skipUnless(ctx task.Context, changed bool, err error) {
+	if err != nil {
+		panic(err)
+	}
+	if !changed {
+		ctx.SkipUpToDate()
+	}
+}
+
+func expand(paths []string) []string {
+	out := make([]string, 0, len(paths))
+	for _, p := range paths {
+		out = append(out, os.ExpandEnv(p))
+	}
+	return out
+}
+
+// newerThan reports whether any of the paths have been modified after t
+func newerThan(t time.Time, paths []string, recursive bool) (bool, error) {
+	if !recursive {
+		for _, p := range paths {
+			stat, err := os.Stat(p)
+			if err != nil {
+				return false, err
+			}
+			if stat.ModTime().After(t) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	newer := false
+	err := walk(paths, func(info os.FileInfo) bool {
+		newer = info.ModTime().After(t)
+		return newer
+	})
+	return newer, err
+}
+
+// errStopWalk stops walking early
+var errStopWalk = errors.New("stop walking")
+
+// walk calls fn for every file and directory under the paths until it returns
+// true
+func walk(paths []string, fn func(info os.FileInfo) bool) error {
+	for _, p := range paths {
+		err := filepath.Walk(p, func(_ string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if fn(info) {
+				return errStopWalk
+			}
+			return nil
+		})
+		if err == errStopWalk {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package task
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// CacheSpec describes what a cacheable task depends on and what it produces
+type CacheSpec struct {
+	// Inputs are files the task reads, given as paths or filepath.Glob
+	// patterns. Directories are walked recursively.
+	Inputs []string
+	// Env are names of environment variables the task reads
+	Env []string
+	// Outputs are files the task produces, given as paths or filepath.Glob
+	// patterns. Directories are walked recursively. Outputs are restored from
+	// the cache when the task is skipped.
+	Outputs []string
+}
+
+// Cacheable is an optional interface of a Runnable whose results are cached.
+//
+// The task is skipped if it has already succeeded with the same inputs: the
+// contents of input files, the values of environment variables and the
+// identity of the Runnable. Its outputs are restored and its output lines are
+// replayed instead. Inputs are hashed after static dependencies of the task
+// have been run, so inputs produced by other tasks must be declared with
+// StaticDeps.
+type Cacheable interface {
+	Cache() CacheSpec
+}
+
+// cachedFile is an output file stored in a cache entry
+type cachedFile struct {
+	Path string
+	Mode os.FileMode
+}
+
+// cacheManifest describes a cache entry
+type cacheManifest struct {
+	Output []LogLine
+	Files  []cachedFile
+}
+
+const manifestFile = "manifest.json"
+
+// expandPaths expands globs and walks directories, returning sorted files.
+// Paths without matches that are not globs are returned as is, so that
+// missing inputs count as well.
+func expandPaths(patterns []string) ([]string, error) {
+	seen := map[string]bool{}
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if len(matches) == 0 && !hasMeta(pattern) {
+			matches = []string{pattern}
+		}
+		for _, match := range matches {
+			err := filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if os.IsNotExist(err) && path == match {
+					info, err = nil, nil
+				}
+				if err != nil {
+					return err
+				}
+				if info != nil && info.IsDir() {
+					return nil
+				}
+				if !seen[path] {
+					seen[path] = true
+					files = append(files, path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func hasMeta(pattern string) bool {
+	for _, c := range pattern {
+		switch c {
+		case '*', '?', '[', '\\':
+			return true
+		}
+	}
+	return false
+}
+
+func hashFile(h io.Writer, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(h, "missing %q\n", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fh := sha256.New()
+	if _, err := io.Copy(fh, f); err != nil {
+		return err
+	}
+	fmt.Fprintf(h, "file %q %x\n", path, fh.Sum(nil))
+	return nil
+}
+
+// cacheKey returns the hash of the inputs of the task
+func cacheKey(r Runnable, spec CacheSpec) (string, error) {
+	h := sha256.New()
+
+	id := interface{}(r)
+	if i, ok := r.(identifiable); ok {
+		id = i.Identify()
+	}
+	fmt.Fprintf(h, "task %s %#v\n", reflect.TypeOf(r), id)
+
+	inputs, err := expandPaths(spec.Inputs)
+	if err != nil {
+		return "", err
+	}
+	for _, input := range inputs {
+		if err := hashFile(h, input); err != nil {
+			return "", err
+		}
+	}
+
+	for _, name := range spec.Env {
+		if val, ok := os.LookupEnv(name); ok {
+			fmt.Fprintf(h, "env %q %q\n", name, val)
+		} else {
+			fmt.Fprintf(h, "unset %q\n", name)
+		}
+	}
+
+	for _, output := range spec.Outputs {
+		fmt.Fprintf(h, "output %q\n", output)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func copyFile(dst, src string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(dst), ".game-cache-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// restoreCached restores outputs of the task from the cache entry and replays
+// its output lines. It returns false if there is no usable entry.
+func restoreCached(tc *taskContext, dir string) bool {
+	data, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil {
+		return false
+	}
+	var manifest cacheManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return false
+	}
+
+	for i, file := range manifest.Files {
+		if err := os.MkdirAll(filepath.Dir(file.Path), 0o755); err != nil {
+			return false
+		}
+		if err := copyFile(file.Path, filepath.Join(dir, strconv.Itoa(i)), file.Mode); err != nil {
+			return false
+		}
+	}
+
+	for _, line := range manifest.Output {
+		if line.Stream == StderrStream {
+			io.WriteString(tc.stderr, line.Line)
+		} else {
+			io.WriteString(tc.stdout, line.Line)
+		}
+	}
+	return true
+}
+
+// saveCached stores outputs and output lines of the succeeded task in the
+// cache entry
+func saveCached(tc *taskContext, dir string, spec CacheSpec) error {
+	outputs, err := expandPaths(spec.Outputs)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(dir), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	manifest := cacheManifest{Output: tc.task.Output}
+	for i, output := range outputs {
+		info, err := os.Stat(output)
+		if err != nil {
+			return fmt.Errorf("output %s: %w", output, err)
+		}
+		if err := copyFile(filepath.Join(tmp, strconv.Itoa(i)), output, info.Mode().Perm()); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, cachedFile{Path: output, Mode: info.Mode().Perm()})
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, manifestFile), data, 0o644); err != nil {
+		return err
+	}
+
+	os.RemoveAll(dir)
+	if err := os.Rename(tmp, dir); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
+
+// runCached runs the task unless its results are found in the cache
+func runCached(ctx Context, tc *taskContext) {
+	t := tc.task
+	c, ok := t.Runnable.(Cacheable)
+	if !ok || t.cacheDir == "" {
+		runWithRetries(ctx, tc)
+		return
+	}
+
+	spec := c.Cache()
+	key, err := cacheKey(t.Runnable, spec)
+	if err != nil {
+		fmt.Fprintf(tc.stderr, "--- Not using cache: %v\n", err)
+		runWithRetries(ctx, tc)
+		return
+	}
+	dir := filepath.Join(t.cacheDir, key[:2], key)
+
+	if restoreCached(tc, dir) {
+		t.Cached = true
+		return
+	}
+
+	runWithRetries(ctx, tc)
+
+	tc.stdout.Flush()
+	tc.stderr.Flush()
+	if err := saveCached(tc, dir, spec); err != nil {
+		fmt.Fprintf(tc.stderr, "--- Failed to save results to cache: %v\n", err)
+	}
+}
@@ -3,11 +3,17 @@ package task
 import (
 	"context"
 	"io"
+	"os"
 )
 
 // Context is a task context
 type Context struct {
 	context.Context
+
+	// failed is called once the task fails, before it gives up its job slot,
+	// so that its siblings are cancelled in fail-fast mode before any of them
+	// takes the slot
+	failed func()
 }
 
 // Dep runs the given tasks as subtasks of the curent task. Dependencies must
@@ -19,19 +25,61 @@ type Context struct {
 // dependencies using Dep. Each dependency is run in their own goroutine. Each
 // function is given the subtask context.
 func (ctx Context) Dep(fns ...interface{}) {
-	runSubtasks(ctx, All.Register(fns))
+	runSubtasks(ctx, All.Register(fns), All.failFast)
+}
+
+// DepFailFast is similar to Dep, with the only difference that the context of
+// remaining subtasks is cancelled as soon as one of them fails.
+func (ctx Context) DepFailFast(fns ...interface{}) {
+	runSubtasks(ctx, All.Register(fns), true)
 }
 
 // SeqDep is similar to Dep, with the only difference that subtasks will be run
 // one after another, not simultaneously.
 //
-// Same as for Dep, if one of subtasks fails, the rest will be run anyway.
+// Same as for Dep, if one of subtasks fails, the rest will be run anyway,
+// unless fail-fast mode is enabled, in which case they are reported cancelled.
 //
 // This function is useful in a very limited number of cases, mostly when there
 // is a number of checks that have to be performed in order and all erorrs need
 // to be conveyed back to user.
 func (ctx Context) SeqDep(fns ...interface{}) {
-	runSubtasksSequential(ctx, All.Register(fns))
+	runSubtasksSequential(ctx, All.Register(fns), All.failFast)
+}
+
+// SkipUpToDate stops the current task, reporting it as skipped because its
+// outputs are up to date. It must be called from the goroutine running the task.
+func (ctx Context) SkipUpToDate() {
+	panic(errUpToDate)
+}
+
+// Acquire takes a slot in the pool for the current task, waiting until one is
+// available. The slot is held until the task finishes or runs subtasks using Dep
+// or SeqDep.
+func (ctx Context) Acquire(pool *Pool) {
+	acquirePool(ctx, pool)
+}
+
+// Watch declares files and directories the current task depends on. In watch
+// mode targets are run again once any of them change.
+func (ctx Context) Watch(paths ...string) {
+	t := taskCtx(ctx).task
+	t.watched = append(t.watched, paths...)
+}
+
+// Produces declares files and directories the current task writes. In watch
+// mode changes to them do not cause targets to run again, even if they are
+// under paths declared with Watch.
+func (ctx Context) Produces(paths ...string) {
+	t := taskCtx(ctx).task
+	t.produced = append(t.produced, paths...)
+}
+
+// Environ returns the environment for commands run by the current task: the
+// environment of the process along with the variables set for the task by
+// Task.SetEnv
+func (ctx Context) Environ() []string {
+	return append(os.Environ(), taskCtx(ctx).task.env...)
 }
 
 // Stdout returns a stdout writer associated with the current task
@@ -0,0 +1,147 @@
+package task
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// historySize is the number of the recent runs of a task kept in the history
+const historySize = 20
+
+// Timing is the duration of a single run of a task
+type Timing struct {
+	Time     time.Time     // when the task finished
+	Duration time.Duration // time the task spent computing, without waiting for subtasks
+}
+
+// History keeps timings of the recent runs of tasks in a file, keyed by names
+// of the tasks
+type History struct {
+	file string
+
+	mu      sync.Mutex
+	timings map[string][]Timing
+}
+
+// NewHistory returns an empty history to be saved to the file
+func NewHistory(file string) *History {
+	return &History{file: file, timings: map[string][]Timing{}}
+}
+
+// LoadHistory reads the history from the file. The history is empty if the
+// file does not exist.
+func LoadHistory(file string) (*History, error) {
+	h := NewHistory(file)
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &h.timings); err != nil {
+		return nil, err
+	}
+	if h.timings == nil {
+		h.timings = map[string][]Timing{}
+	}
+	return h, nil
+}
+
+// Names returns sorted names of the tasks in the history
+func (h *History) Names() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	names := make([]string, 0, len(h.timings))
+	for name := range h.timings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Timings returns the timings of the recent runs of the task, oldest first
+func (h *History) Timings(name string) []Timing {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]Timing(nil), h.timings[name]...)
+}
+
+// Median returns the median duration of the recent runs of the task along with
+// the number of the runs. Both are zero if the task has not been run.
+func (h *History) Median(name string) (time.Duration, int) {
+	timings := h.Timings(name)
+	if len(timings) == 0 {
+		return 0, 0
+	}
+	durations := make([]time.Duration, 0, len(timings))
+	for _, timing := range timings {
+		durations = append(durations, timing.Duration)
+	}
+	sort.Slice(durations, func(i, j int) bool {
+		return durations[i] < durations[j]
+	})
+	n := len(durations)
+	if n%2 == 1 {
+		return durations[n/2], n
+	}
+	return (durations[n/2-1] + durations[n/2]) / 2, n
+}
+
+// Record adds timings of the tasks that have succeeded computing to the
+// history. Tasks restored from the cache or found up to date are left out, as
+// their durations say nothing about how long the tasks take.
+func (h *History) Record(tasks []*Task) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, t := range tasks {
+		if len(t.Spans) == 0 || t.Error != nil || t.Cached || t.UpToDate {
+			continue
+		}
+		name := t.Name()
+		timings := append(h.timings[name], Timing{Time: t.End(), Duration: t.SelfDuration()})
+		sort.SliceStable(timings, func(i, j int) bool {
+			return timings[i].Time.Before(timings[j].Time)
+		})
+		if len(timings) > historySize {
+			timings = timings[len(timings)-historySize:]
+		}
+		h.timings[name] = timings
+	}
+}
+
+// Save writes the history to its file
+func (h *History) Save() error {
+	h.mu.Lock()
+	data, err := json.Marshal(h.timings)
+	h.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(h.file), 0o755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(h.file), ".history-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), h.file)
+}
@@ -0,0 +1,38 @@
+package task
+
+// jobSlots limits the number of tasks computing simultaneously. Tasks waiting
+// for their subtasks do not hold a slot. A nil jobSlots imposes no limit.
+type jobSlots chan struct{}
+
+func newJobSlots(n int) jobSlots {
+	if n <= 0 {
+		return nil
+	}
+	return make(jobSlots, n)
+}
+
+func (js jobSlots) acquire() {
+	if js != nil {
+		js <- struct{}{}
+	}
+}
+
+// acquireUnlessDone takes a slot like acquire, unless done is closed first. It
+// returns false if no slot has been taken.
+func (js jobSlots) acquireUnlessDone(done <-chan struct{}) bool {
+	if js == nil {
+		return true
+	}
+	select {
+	case js <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (js jobSlots) release() {
+	if js != nil {
+		<-js
+	}
+}
@@ -0,0 +1,79 @@
+package task
+
+import "fmt"
+
+// Pool is a named resource shared by tasks, such as a local database or a range
+// of ports, that only a limited number of tasks may use simultaneously
+type Pool struct {
+	name  string
+	slots chan struct{}
+}
+
+// NewPool declares a pool with the given number of slots
+func NewPool(name string, capacity int) *Pool {
+	if capacity <= 0 {
+		panic(fmt.Errorf("pool %s must have a positive capacity, got %d", name, capacity))
+	}
+	return &Pool{name: name, slots: make(chan struct{}, capacity)}
+}
+
+// Name returns the name of the pool
+func (p *Pool) Name() string {
+	return p.name
+}
+
+func (p *Pool) String() string {
+	return p.name
+}
+
+// PoolReporter is an optional interface of a Reporter interested in tasks
+// waiting for pool slots
+type PoolReporter interface {
+	// PoolWaiting is called when a task starts waiting for a slot in the pool
+	PoolWaiting(t *Task, pool *Pool)
+	// PoolAcquired is called when a waiting task gets a slot in the pool
+	PoolAcquired(t *Task, pool *Pool)
+}
+
+func acquirePool(ctx Context, pool *Pool) {
+	tc := taskCtx(ctx)
+	for _, p := range tc.pools {
+		if p == pool {
+			return
+		}
+	}
+
+	select {
+	case pool.slots <- struct{}{}:
+	default:
+		for _, r := range tc.task.reporters {
+			if pr, ok := r.(PoolReporter); ok {
+				pr.PoolWaiting(tc.task, pool)
+			}
+		}
+
+		// Waiting for a pool does not count against the job limit
+		tc.task.jobs.release()
+		select {
+		case pool.slots <- struct{}{}:
+		case <-ctx.Done():
+			tc.task.jobs.acquire()
+			panic(ctx.Err())
+		}
+		tc.task.jobs.acquire()
+
+		for _, r := range tc.task.reporters {
+			if pr, ok := r.(PoolReporter); ok {
+				pr.PoolAcquired(tc.task, pool)
+			}
+		}
+	}
+	tc.pools = append(tc.pools, pool)
+}
+
+func (tc *taskContext) releasePools() {
+	for _, pool := range tc.pools {
+		<-pool.slots
+	}
+	tc.pools = nil
+}
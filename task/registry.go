@@ -37,10 +37,14 @@ type Reporter interface {
 type Registry struct {
 	reporters []Reporter
 	module    string
-
-	mu     sync.Mutex
-	tasks  map[interface{}]*Task
-	nextID int
+	jobs      jobSlots
+	failFast  bool
+	cacheDir  string
+
+	mu           sync.Mutex
+	tasks        map[interface{}]*Task
+	deprecations map[interface{}]string
+	nextID       int
 }
 
 // Runnable is a named piece of runnable code
@@ -52,6 +56,13 @@ type identifiable interface {
 	Identify() interface{}
 }
 
+// StaticDeps is an optional interface of a Runnable that declares its
+// dependencies upfront. Declared dependencies are run as by Context.Dep before
+// the Runnable is run, and are known without running any tasks.
+type StaticDeps interface {
+	Deps() []interface{}
+}
+
 type taskID struct {
 	Type reflect.Type
 	ID   interface{}
@@ -77,9 +88,12 @@ func (r *Registry) Register(fns []interface{}) []*Task {
 
 		if _, exists := r.tasks[identity]; !exists {
 			r.tasks[identity] = &Task{
-				ID:        r.nextID,
-				Runnable:  runnable,
-				reporters: r.reporters,
+				ID:          r.nextID,
+				Runnable:    runnable,
+				reporters:   r.reporters,
+				jobs:        r.jobs,
+				cacheDir:    r.cacheDir,
+				deprecation: r.deprecations[identity],
 			}
 			r.nextID++
 		}
@@ -88,6 +102,49 @@ func (r *Registry) Register(fns []interface{}) []*Task {
 	return out
 }
 
+// StaticDeps returns the subtasks the task declares statically, and whether the
+// task declares them at all
+func (r *Registry) StaticDeps(t *Task) ([]*Task, bool) {
+	sd, ok := t.Runnable.(StaticDeps)
+	if !ok {
+		return nil, false
+	}
+	return r.Register(sd.Deps()), true
+}
+
+// Timeouter is an optional interface of a Runnable that limits its own running
+// time. The context of the task and its subtasks is cancelled once the timeout
+// expires, and the task failing after that is reported with a TimeoutError.
+// Subtasks failing after that are reported cancelled.
+type Timeouter interface {
+	Timeout() time.Duration
+}
+
+// Deprecate marks the runnable as deprecated: once its task starts, the
+// message is sent to the reporters as a warning on stderr of the task. The
+// warning is not stored in the output of the task.
+func (r *Registry) Deprecate(fn interface{}, message string) {
+	runnable := mustFuncsToRunnable(r.module, []interface{}{fn})[0]
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.deprecations == nil {
+		r.deprecations = map[interface{}]string{}
+	}
+	r.deprecations[identify(runnable)] = message
+}
+
+// Reset forgets all registered tasks, so that they are run again once
+// registered anew. It must not be called while tasks are running.
+func (r *Registry) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.tasks = map[interface{}]*Task{}
+	r.nextID = 0
+}
+
 // Tasks returns tasks
 func (r *Registry) Tasks() []*Task {
 	ts := []*Task{}
@@ -107,6 +164,24 @@ func AddReporter(reporter Reporter) {
 	All.reporters = append(All.reporters, reporter)
 }
 
+// SetJobs limits the number of tasks computing simultaneously. Zero means no
+// limit.
+func SetJobs(n int) {
+	All.jobs = newJobSlots(n)
+}
+
+// SetFailFast enables fail-fast mode: once a subtask fails, the context of the
+// remaining subtasks is cancelled and sequential subtasks are not started
+func SetFailFast(failFast bool) {
+	All.failFast = failFast
+}
+
+// SetCacheDir sets the directory where results of Cacheable tasks are stored.
+// Caching is disabled if it is empty.
+func SetCacheDir(dir string) {
+	All.cacheDir = dir
+}
+
 // SetModule sets the code module
 func SetModule(module string) {
 	All.module = module
@@ -0,0 +1,114 @@
+package task
+
+import (
+	"fmt"
+	"time"
+)
+
+// RetryPolicy describes how a failed task is retried
+type RetryPolicy struct {
+	// Attempts is the maximum number of attempts, including the first one
+	Attempts int
+	// Backoff is the delay before the second attempt, doubled for every
+	// following one
+	Backoff time.Duration
+	// Retryable reports whether the task that failed with the error should be
+	// retried. All errors are retryable if it is nil.
+	Retryable func(err error) bool
+}
+
+// Retrier is an optional interface of a Runnable that is retried on failure.
+// Failures of subtasks are never retried, as each subtask is run only once.
+type Retrier interface {
+	RetryPolicy() RetryPolicy
+}
+
+// RetryReporter is an optional interface of a Reporter interested in retries
+// of tasks
+type RetryReporter interface {
+	// Retrying is called before every attempt of the task after the first one
+	Retrying(t *Task, attempt int, err error)
+}
+
+func (rp RetryPolicy) retryable(attempt int, err error) bool {
+	if attempt >= rp.Attempts {
+		return false
+	}
+	if err == errUpToDate {
+		return false
+	}
+	if _, ok := err.(SubtasksFailure); ok {
+		return false
+	}
+	return rp.Retryable == nil || rp.Retryable(err)
+}
+
+func panicError(e interface{}) error {
+	if err, ok := e.(error); ok {
+		return err
+	}
+	return fmt.Errorf("%v", e)
+}
+
+// runAttempt runs the task once and returns the error it failed with
+func runAttempt(ctx Context, r Runnable) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = panicError(e)
+		}
+	}()
+	r.Run(ctx)
+	return nil
+}
+
+// runWithRetries runs the task, retrying it according to the policy of its
+// Runnable. Every attempt starts a new span, and the output of failed attempts
+// is followed by a line describing the failure.
+func runWithRetries(ctx Context, tc *taskContext) {
+	t := tc.task
+	rr, ok := t.Runnable.(Retrier)
+	if !ok {
+		t.Runnable.Run(ctx)
+		return
+	}
+
+	policy := rr.RetryPolicy()
+	backoff := policy.Backoff
+	for {
+		err := runAttempt(ctx, t.Runnable)
+		if err == nil {
+			t.Error = nil
+			return
+		}
+		if !policy.retryable(tc.attempt, err) || ctx.Err() != nil {
+			panic(err)
+		}
+
+		tc.stdout.Flush()
+		tc.stderr.Flush()
+		fmt.Fprintf(tc.stderr, "--- Attempt %d of %d failed: %v\n", tc.attempt, policy.Attempts, err)
+		tc.closeSpan(nil)
+
+		if backoff > 0 {
+			// Waiting for the next attempt does not count against the job limit
+			t.jobs.release()
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				t.jobs.acquire()
+				panic(err)
+			}
+			t.jobs.acquire()
+			tc.nextSpanStart = time.Now()
+			backoff *= 2
+		}
+
+		tc.attempt++
+		t.Error = nil
+		for _, r := range t.reporters {
+			if rr, ok := r.(RetryReporter); ok {
+				rr.Retrying(t, tc.attempt, err)
+			}
+		}
+	}
+}
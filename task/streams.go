@@ -2,6 +2,7 @@ package task
 
 import (
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -53,13 +54,18 @@ func (sls *streamLineSink) Flush(t time.Time) {
 }
 
 // streamLineWriter is a Writer for an output stream that flushes any pending
-// data from other stream
+// data from other stream. Writers of both streams may be used concurrently, e.g.
+// by exec.Cmd.
 type streamLineWriter struct {
+	mu    *sync.Mutex // shared by the writers of both streams
 	sink  *streamLineSink
 	other *streamLineSink
 }
 
 func (slw streamLineWriter) Write(p []byte) (int, error) {
+	slw.mu.Lock()
+	defer slw.mu.Unlock()
+
 	t := time.Now()
 	slw.other.Flush(t)
 	slw.sink.Add(t, string(p))
@@ -67,12 +73,16 @@ func (slw streamLineWriter) Write(p []byte) (int, error) {
 }
 
 func (slw streamLineWriter) Flush() {
+	slw.mu.Lock()
+	defer slw.mu.Unlock()
+
 	slw.sink.Flush(time.Now())
 }
 
 func newStreamLineWriters(task *Task, reporters []Reporter) (flushWriter, flushWriter) {
+	mu := &sync.Mutex{}
 	stdoutSink := &streamLineSink{task: task, reporters: reporters, stream: StdoutStream}
 	stderrSink := &streamLineSink{task: task, reporters: reporters, stream: StderrStream}
 
-	return streamLineWriter{stdoutSink, stderrSink}, streamLineWriter{stderrSink, stdoutSink}
+	return streamLineWriter{mu, stdoutSink, stderrSink}, streamLineWriter{mu, stderrSink, stdoutSink}
 }
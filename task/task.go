@@ -2,8 +2,10 @@ package task
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
@@ -16,6 +18,7 @@ type Span struct {
 	End   time.Time
 
 	Subtasks []*Task
+	Attempt  int // attempt of running the task the span belongs to, starting from 1
 }
 
 // Task contains information about single execution of a task
@@ -25,11 +28,21 @@ type Task struct {
 
 	once      sync.Once
 	reporters []Reporter
+	jobs      jobSlots
+	cacheDir  string
+	watched   []string
+	produced  []string
+	env       []string // variables added to the environment of commands run by the task
+
+	deprecation string // warning sent to reporters once the task starts
 
 	// Fields below are filled during t.Run()
-	Spans  []Span
-	Error  error // nil if the task succeeded
-	Output []LogLine
+	Spans     []Span
+	Error     error // nil if the task succeeded
+	Cancelled bool  // true if the task failed after its context was cancelled
+	Cached    bool  // true if the task was skipped and its results were restored from the cache
+	UpToDate  bool  // true if the task skipped the rest of its work as its outputs were up to date
+	Output    []LogLine
 }
 
 // StringID formats task ID
@@ -92,6 +105,69 @@ func (t *Task) Duration() time.Duration {
 	return t.End().Sub(t.Spans[0].Start)
 }
 
+// Attempts returns the number of attempts made to run the task
+func (t *Task) Attempts() int {
+	n := 1
+	for _, s := range t.Spans {
+		if s.Attempt > n {
+			n = s.Attempt
+		}
+	}
+	return n
+}
+
+// WatchPaths returns the files and directories the task has declared it depends
+// on, either using Context.Watch or as inputs of a Cacheable. Directories
+// containing glob patterns are returned for the patterns.
+func (t *Task) WatchPaths() []string {
+	paths := append([]string{}, t.watched...)
+	if c, ok := t.Runnable.(Cacheable); ok {
+		for _, input := range c.Cache().Inputs {
+			for hasMeta(input) {
+				input = filepath.Dir(input)
+			}
+			paths = append(paths, input)
+		}
+	}
+	return paths
+}
+
+// OutputPaths returns the files and directories the task has declared it
+// writes, either using Context.Produces or as outputs of a Cacheable. Outputs of
+// a Cacheable may be glob patterns.
+func (t *Task) OutputPaths() []string {
+	paths := append([]string{}, t.produced...)
+	if c, ok := t.Runnable.(Cacheable); ok {
+		paths = append(paths, c.Cache().Outputs...)
+	}
+	return paths
+}
+
+// Status returns the outcome of the finished task: "succeeded", "cached",
+// "skipped", "failed", "cancelled" or "timedout"
+func (t *Task) Status() string {
+	switch {
+	case t.Cached:
+		return "cached"
+	case t.UpToDate:
+		return "skipped"
+	case t.Error == nil:
+		return "succeeded"
+	case t.Cancelled:
+		return "cancelled"
+	}
+	if _, ok := t.Error.(TimeoutError); ok {
+		return "timedout"
+	}
+	return "failed"
+}
+
+// SetEnv adds the variable to the environment of commands run by the task, see
+// Context.Environ. Reporters may call it once the task is started.
+func (t *Task) SetEnv(name, value string) {
+	t.env = append(t.env, name+"="+value)
+}
+
 // SelfDuration returns duration of task computation without subtasks
 func (t *Task) SelfDuration() time.Duration {
 	var d time.Duration
@@ -111,6 +187,9 @@ type contextKey string
 
 const (
 	taskContextKey = contextKey("game.task")
+	// timeoutContextKey keeps the timeout context of the nearest task with
+	// a timeout
+	timeoutContextKey = contextKey("game.timeout")
 )
 
 type flushWriter interface {
@@ -122,8 +201,12 @@ type taskContext struct {
 	task *Task
 
 	nextSpanStart time.Time
+	attempt       int
 	stdout        flushWriter
 	stderr        flushWriter
+
+	// pools acquired during the current span
+	pools []*Pool
 }
 
 func taskCtx(ctx Context) *taskContext {
@@ -141,43 +224,98 @@ func Stderr(ctx Context) io.Writer {
 }
 
 func (tc *taskContext) closeSpan(subtasks []*Task) {
+	tc.releasePools()
+
 	endTime := time.Now()
-	tc.task.Spans = append(tc.task.Spans, Span{Start: tc.nextSpanStart, End: endTime, Subtasks: subtasks})
+	tc.task.Spans = append(tc.task.Spans, Span{Start: tc.nextSpanStart, End: endTime, Subtasks: subtasks, Attempt: tc.attempt})
 	tc.nextSpanStart = endTime
 }
 
 func (t *Task) run(ctx Context) {
+	acquired := t.jobs.acquireUnlessDone(ctx.Done())
+
 	for _, r := range t.reporters {
 		r.Started(t)
 	}
+	if t.deprecation != "" {
+		line := LogLine{Stream: StderrStream, Line: "warning: " + t.deprecation + "\n"}
+		now := time.Now()
+		for _, r := range t.reporters {
+			r.OutputLine(t, now, line)
+		}
+	}
 
 	stdout, stderr := newStreamLineWriters(t, t.reporters)
 
 	tc := &taskContext{
 		task:          t,
 		nextSpanStart: time.Now(),
+		attempt:       1,
 		stdout:        stdout,
 		stderr:        stderr,
 	}
 	ctx.Context = context.WithValue(ctx.Context, taskContextKey, tc)
 
+	parent := ctx.Context
+	var timeout time.Duration
+	if tr, ok := t.Runnable.(Timeouter); ok && tr.Timeout() > 0 {
+		timeout = tr.Timeout()
+		timeoutCtx, cancel := context.WithTimeout(ctx.Context, timeout)
+		defer cancel()
+		ctx.Context = context.WithValue(timeoutCtx, timeoutContextKey, timeoutCtx)
+	}
+
 	defer func() {
 		tc.closeSpan(nil)
 
-		if e := recover(); e != nil {
-			if err, ok := e.(error); ok {
-				t.Error = err
+		if e := recover(); e == errUpToDate {
+			t.UpToDate = true
+		} else if e != nil {
+			t.Error = panicError(e)
+			if timeout != 0 && parent.Err() == nil && ctx.Err() == context.DeadlineExceeded {
+				t.Error = TimeoutError{Timeout: timeout, Err: t.Error}
 			} else {
-				t.Error = fmt.Errorf("%v", e)
+				t.Cancelled = cancelled(parent)
 			}
 		}
 
+		if t.Error != nil && ctx.failed != nil {
+			ctx.failed()
+		}
+		if acquired {
+			t.jobs.release()
+		}
+
 		for _, r := range t.reporters {
 			r.Finished(t)
 		}
 	}()
 
-	t.Runnable.Run(ctx)
+	// The task may have been cancelled while waiting for a job slot, e.g. once
+	// a sibling has failed in fail-fast mode
+	if err := ctx.Err(); err != nil {
+		t.Error = err
+		t.Cancelled = cancelled(parent)
+		return
+	}
+
+	if sd, ok := t.Runnable.(StaticDeps); ok {
+		if deps := sd.Deps(); len(deps) > 0 {
+			ctx.Dep(deps...)
+		}
+	}
+	runCached(ctx, tc)
+}
+
+// cancelled tells whether a task that has failed in the context has failed due
+// to cancellation: of the run, e.g. in fail-fast mode, or of a task it is a
+// subtask of once that task has exceeded its timeout
+func cancelled(ctx context.Context) bool {
+	if ctx.Err() == context.Canceled {
+		return true
+	}
+	timeoutCtx, ok := ctx.Value(timeoutContextKey).(context.Context)
+	return ok && timeoutCtx.Err() == context.DeadlineExceeded
 }
 
 // Run runs the task
@@ -187,6 +325,24 @@ func (t *Task) Run(ctx Context) {
 	})
 }
 
+// errUpToDate stops the task that has found its outputs up to date
+var errUpToDate = errors.New("up to date")
+
+// TimeoutError is an error of a task that failed after exceeding its own
+// timeout
+type TimeoutError struct {
+	Timeout time.Duration
+	Err     error // the error the task failed with
+}
+
+func (te TimeoutError) Error() string {
+	return fmt.Sprintf("Exceeded timeout of %s", te.Timeout)
+}
+
+func (te TimeoutError) Unwrap() error {
+	return te.Err
+}
+
 // SubtasksFailure is an error raised if any subtask of a task has failed
 type SubtasksFailure []*Task
 
@@ -198,14 +354,46 @@ func plural(name string, count int) string {
 	return name + "s"
 }
 
-func (st SubtasksFailure) Error() string {
-	ids := make([]string, 0, len(st))
+// Failed returns the subtasks that failed on their own, not due to cancellation
+func (st SubtasksFailure) Failed() []*Task {
+	var out []*Task
 	for _, subtask := range st {
-		ids = append(ids, subtask.String())
+		if !subtask.Cancelled {
+			out = append(out, subtask)
+		}
 	}
-	return fmt.Sprintf("Failed %s: %s",
-		plural("subtask", len(st)),
-		strings.Join(ids, ", "))
+	return out
+}
+
+// Cancelled returns the subtasks that failed due to cancellation
+func (st SubtasksFailure) Cancelled() []*Task {
+	var out []*Task
+	for _, subtask := range st {
+		if subtask.Cancelled {
+			out = append(out, subtask)
+		}
+	}
+	return out
+}
+
+func taskList(tasks []*Task) string {
+	ids := make([]string, 0, len(tasks))
+	for _, t := range tasks {
+		ids = append(ids, t.String())
+	}
+	return strings.Join(ids, ", ")
+}
+
+func (st SubtasksFailure) Error() string {
+	failed, cancelled := st.Failed(), st.Cancelled()
+	if len(failed) == 0 {
+		return fmt.Sprintf("Cancelled %s: %s", plural("subtask", len(cancelled)), taskList(cancelled))
+	}
+	msg := fmt.Sprintf("Failed %s: %s", plural("subtask", len(failed)), taskList(failed))
+	if len(cancelled) > 0 {
+		msg += fmt.Sprintf("; cancelled %s: %s", plural("subtask", len(cancelled)), taskList(cancelled))
+	}
+	return msg
 }
 
 func reportFailures(tc *taskContext, failures []*Task) {
@@ -218,17 +406,28 @@ func reportFailures(tc *taskContext, failures []*Task) {
 
 // runSubtasks runs given tasks as subtasks of the task in the context in
 // parallel. All tasks are allowed to finish even if some of them error out, and
-// errors from all subtasks are collected.
-func runSubtasks(ctx Context, subtasks []*Task) {
+// errors from all subtasks are collected. In fail-fast mode the context of
+// subtasks is cancelled once any of them fails.
+func runSubtasks(ctx Context, subtasks []*Task, failFast bool) {
 	tc := taskCtx(ctx)
 	tc.closeSpan(nil)
 
+	cancel := func() {}
+	if failFast {
+		ctx.Context, cancel = context.WithCancel(ctx.Context)
+	}
+	defer cancel()
+	ctx.failed = cancel
+
 	finishedCh := make(chan *Task, len(subtasks))
 
 	for _, r := range tc.task.reporters {
 		r.Dependencies(tc.task, subtasks, false)
 	}
 
+	// Waiting for subtasks does not count against the job limit
+	tc.task.jobs.release()
+
 	for _, subtask := range subtasks {
 		go func(subtask *Task) {
 			subtask.Run(ctx)
@@ -242,9 +441,11 @@ func runSubtasks(ctx Context, subtasks []*Task) {
 		subtask := <-finishedCh
 		if subtask.Error != nil {
 			f = append(f, subtask)
+			cancel()
 		}
 	}
 
+	tc.task.jobs.acquire()
 	tc.closeSpan(subtasks)
 
 	if len(f) > 0 {
@@ -252,14 +453,26 @@ func runSubtasks(ctx Context, subtasks []*Task) {
 	}
 }
 
-func runSubtasksSequential(ctx Context, subtasks []*Task) {
+// runSubtasksSequential runs given tasks as subtasks of the task in the
+// context one after another. In fail-fast mode the subtasks remaining once any
+// of them fails are reported cancelled instead of being run.
+func runSubtasksSequential(ctx Context, subtasks []*Task, failFast bool) {
 	tc := taskCtx(ctx)
 	tc.closeSpan(nil)
 
+	cancel := func() {}
+	if failFast {
+		ctx.Context, cancel = context.WithCancel(ctx.Context)
+	}
+	defer cancel()
+	ctx.failed = cancel
+
 	for _, r := range tc.task.reporters {
 		r.Dependencies(tc.task, subtasks, true)
 	}
 
+	tc.task.jobs.release()
+
 	var f []*Task
 
 	for _, subtask := range subtasks {
@@ -269,6 +482,7 @@ func runSubtasksSequential(ctx Context, subtasks []*Task) {
 		}
 	}
 
+	tc.task.jobs.acquire()
 	tc.closeSpan(subtasks)
 
 	if len(f) > 0 {
@@ -0,0 +1,106 @@
+package toplevel
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+// targetCall is a target invocation from the command line
+type targetCall struct {
+	target *Target
+	args   []string
+}
+
+// parseTargetCalls splits command-line arguments into target invocations. Each
+// target consumes as many following arguments as it has parameters. If prefix
+// is set, targets may be given by unambiguous prefixes of their names.
+func parseTargetCalls(targets []Target, args []string, prefix bool) (calls []targetCall, unknown []string, err error) {
+	for i := 0; i < len(args); i++ {
+		target, err := resolveTarget(targets, args[i], prefix)
+		if err != nil {
+			return nil, nil, err
+		}
+		if target == nil {
+			unknown = append(unknown, args[i])
+			continue
+		}
+		rest := args[i+1:]
+		if len(rest) < len(target.Args) {
+			return nil, nil, fmt.Errorf("Not enough arguments for target %s: expected %d, got %d\nUsage: %s",
+				target.Name, len(target.Args), len(rest), target.Usage())
+		}
+		calls = append(calls, targetCall{target: target, args: rest[:len(target.Args)]})
+		i += len(target.Args)
+	}
+	return calls, unknown, nil
+}
+
+func convertArg(typ string, s string) (interface{}, error) {
+	switch typ {
+	case "string":
+		return s, nil
+	case "int":
+		return strconv.Atoi(s)
+	case "bool":
+		return strconv.ParseBool(s)
+	case "float64":
+		return strconv.ParseFloat(s, 64)
+	case "time.Duration":
+		return time.ParseDuration(s)
+	default:
+		return nil, fmt.Errorf("unsupported argument type %s", typ)
+	}
+}
+
+// argsFn is a target function bound to its command-line arguments
+type argsFn struct {
+	name string
+	fn   interface{}
+	args []interface{}
+}
+
+// Target functions with different arguments are different tasks
+func (af argsFn) Identify() interface{} {
+	return af.String()
+}
+
+func (af argsFn) String() string {
+	s := []string{af.name}
+	for _, arg := range af.args {
+		s = append(s, fmt.Sprint(arg))
+	}
+	return strings.Join(s, " ")
+}
+
+func (af argsFn) Run(ctx task.Context) {
+	in := []reflect.Value{reflect.ValueOf(ctx)}
+	for _, arg := range af.args {
+		in = append(in, reflect.ValueOf(arg))
+	}
+	out := reflect.ValueOf(af.fn).Call(in)
+	if len(out) == 1 && !out[0].IsNil() {
+		panic(out[0].Interface())
+	}
+}
+
+// fn returns the function to register as a task for the target invocation
+func (tc targetCall) fn() (interface{}, error) {
+	if len(tc.target.Args) == 0 {
+		return tc.target.Fn, nil
+	}
+	af := argsFn{name: tc.target.Name, fn: tc.target.Fn}
+	for i, arg := range tc.target.Args {
+		v, err := convertArg(arg.Type, tc.args[i])
+		if err != nil {
+			return nil, fmt.Errorf("Invalid value %q of argument %s (%s) for target %s: %v",
+				tc.args[i], arg.Name, arg.Type, tc.target.Name, err)
+		}
+		af.args = append(af.args, v)
+	}
+	return af, nil
+}
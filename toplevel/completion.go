@@ -0,0 +1,231 @@
+package toplevel
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// CompletionFlag is a command-line flag completed by shell completion scripts
+type CompletionFlag struct {
+	Name    string
+	Usage   string
+	Value   string   // kind of the value: "" for boolean flags, "file", "dir", "choice" or "string"
+	Choices []string // possible values of a "choice" flag
+}
+
+// CompletionFlags describes the flags of fs for shell completion. values maps
+// flag names to kinds of their values: "file", "dir", or a space-separated list
+// of choices. Values of other non-boolean flags are not completed. Flags
+// without usage text are hidden.
+func CompletionFlags(fs *flag.FlagSet, values map[string]string) []CompletionFlag {
+	var flags []CompletionFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Usage == "" {
+			return
+		}
+		cf := CompletionFlag{Name: f.Name, Usage: f.Usage}
+		switch v := values[f.Name]; {
+		case isBoolFlag(f):
+		case v == "":
+			cf.Value = "string"
+		case v == "file" || v == "dir":
+			cf.Value = v
+		default:
+			cf.Value = "choice"
+			cf.Choices = strings.Fields(v)
+		}
+		flags = append(flags, cf)
+	})
+	return flags
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && bf.IsBoolFlag()
+}
+
+var nonIdentRx = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// quote quotes s for the shell in single quotes
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// zshDesc escapes s for a description in a zsh _arguments spec
+func zshDesc(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`, ":", `\:`, "'", `'\''`).Replace(s)
+}
+
+// fishQuote quotes s for fish in single quotes
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(s) + "'"
+}
+
+var completionFuncs = template.FuncMap{
+	"quote":     quote,
+	"zshDesc":   zshDesc,
+	"fishQuote": fishQuote,
+	"join":      strings.Join,
+}
+
+// Targets are listed by running the program with -complete-targets, passing
+// the -d flag along if it has been given. Target names may contain colons,
+// which bash treats as word separators, so the whole word is taken from the
+// command line instead, and the part up to the last colon is removed from the
+// completions.
+var bashCompletionTpl = template.Must(template.New("bash").Funcs(completionFuncs).Parse(`# bash completion for {{.Prog}}
+
+_{{.Func}}() {
+    local line="${COMP_LINE:0:COMP_POINT}"
+    local cur="${line##*[[:space:]]}"
+    local prev="${COMP_WORDS[COMP_CWORD-1]}"
+    [[ "$prev" == ":" || "$cur" == *:* ]] && prev=""
+
+    case "$prev" in
+{{- range .Flags}}{{if .Value}}
+    -{{.Name}})
+{{- if eq .Value "file"}}
+        COMPREPLY=($(compgen -f -- "$cur"))
+{{- else if eq .Value "dir"}}
+        COMPREPLY=($(compgen -d -- "$cur"))
+{{- else if eq .Value "choice"}}
+        COMPREPLY=($(compgen -W {{quote (join .Choices " ")}} -- "$cur"))
+{{- else}}
+        COMPREPLY=()
+{{- end}}
+        return
+        ;;
+{{- end}}{{end}}
+    esac
+
+    if [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W {{quote .FlagNames}} -- "$cur"))
+        return
+    fi
+
+    local dir=() i
+    for ((i = 1; i < COMP_CWORD; i++)); do
+        if [[ "${COMP_WORDS[i]}" == -d ]]; then
+            dir=(-d "${COMP_WORDS[i+1]}")
+        fi
+    done
+    COMPREPLY=($(compgen -W "$("${COMP_WORDS[0]}" "${dir[@]}" -complete-targets 2>/dev/null)" -- "$cur"))
+    if [[ "$cur" == *:* ]]; then
+        local prefix="${cur%"${cur##*:}"}"
+        COMPREPLY=("${COMPREPLY[@]#"$prefix"}")
+    fi
+}
+
+complete -F _{{.Func}} {{.Prog}}
+`))
+
+var zshCompletionTpl = template.Must(template.New("zsh").Funcs(completionFuncs).Parse(`#compdef {{.Prog}}
+
+_{{.Func}}() {
+    local -a targets dir
+    local i state
+    for ((i = 2; i < CURRENT; i++)); do
+        if [[ ${words[i]} == -d ]]; then
+            dir=(-d ${words[i+1]})
+        fi
+    done
+
+    _arguments \
+{{- range .Flags}}
+        '-{{.Name}}[{{zshDesc .Usage}}]
+{{- if eq .Value "file"}}:file:_files
+{{- else if eq .Value "dir"}}:directory:_files -/
+{{- else if eq .Value "choice"}}:value:({{join .Choices " "}})
+{{- else if .Value}}:value:
+{{- end}}' \
+{{- end}}
+        '*: :->targets'
+
+    if [[ $state == targets ]]; then
+        targets=(${(f)"$(${words[1]} $dir -complete-targets 2>/dev/null)"})
+        compadd -a targets
+    fi
+}
+
+if [[ $funcstack[1] == _{{.Func}} ]]; then
+    _{{.Func}} "$@"
+else
+    compdef _{{.Func}} {{.Prog}}
+fi
+`))
+
+var fishCompletionTpl = template.Must(template.New("fish").Funcs(completionFuncs).Parse(`# fish completion for {{.Prog}}
+
+function __{{.Func}}_targets
+    set -l cmd (commandline -opc)
+    set -l dir
+    if set -l i (contains -i -- -d $cmd)
+        set dir -d $cmd[(math $i + 1)]
+    end
+    $cmd[1] $dir -complete-targets 2>/dev/null
+end
+
+complete -c {{.Prog}} -f -a '(__{{.Func}}_targets)'
+{{- range .Flags}}
+complete -c {{$.Prog}} -o {{.Name}} -d {{fishQuote .Usage}}
+{{- if eq .Value "file"}} -r -F
+{{- else if eq .Value "dir"}} -x -a '(__fish_complete_directories (commandline -ct))'
+{{- else if eq .Value "choice"}} -x -a {{fishQuote (join .Choices " ")}}
+{{- else if .Value}} -x
+{{- end}}
+{{- end}}
+`))
+
+// CompletionScript returns a script for the shell ("bash", "zsh" or "fish")
+// completing the flags and targets of the program. Targets are listed by
+// running the program with the -complete-targets flag.
+func CompletionScript(shell string, prog string, flags []CompletionFlag) (string, error) {
+	tpls := map[string]*template.Template{
+		"bash": bashCompletionTpl,
+		"zsh":  zshCompletionTpl,
+		"fish": fishCompletionTpl,
+	}
+	tpl, ok := tpls[shell]
+	if !ok {
+		return "", fmt.Errorf("unsupported shell %q for completion, must be bash, zsh or fish", shell)
+	}
+
+	var names []string
+	for _, f := range flags {
+		names = append(names, "-"+f.Name)
+	}
+	data := struct {
+		Prog      string
+		Func      string
+		Flags     []CompletionFlag
+		FlagNames string
+	}{
+		Prog:      prog,
+		Func:      nonIdentRx.ReplaceAllString(prog, "_"),
+		Flags:     flags,
+		FlagNames: strings.Join(names, " "),
+	}
+
+	b := strings.Builder{}
+	if err := tpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// listTargetNames prints names and aliases of targets one per line for
+// completion scripts. Hidden targets are left out.
+func listTargetNames(targets []Target) {
+	for _, target := range targets {
+		if target.Hidden {
+			continue
+		}
+		fmt.Println(target.Name)
+		for _, alias := range target.Aliases {
+			fmt.Println(alias)
+		}
+	}
+}
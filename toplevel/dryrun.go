@@ -0,0 +1,38 @@
+package toplevel
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ridge/game/task"
+)
+
+// printPlan prints the graph of tasks that would be run, without running them.
+// Tasks that do not declare their dependencies statically are shown as leaves.
+func printPlan(tasks []*task.Task) {
+	seenTasks := map[*task.Task]bool{}
+
+	var printTask func(t *task.Task, indent int)
+	printTask = func(t *task.Task, indent int) {
+		prefix := strings.Repeat("    ", indent) + t.String()
+		if seenTasks[t] {
+			fmt.Printf("%s <see above>\n", prefix)
+			return
+		}
+		seenTasks[t] = true
+
+		deps, static := task.All.StaticDeps(t)
+		if !static {
+			fmt.Printf("%s <dependencies unknown>\n", prefix)
+			return
+		}
+		fmt.Println(prefix)
+		for _, dep := range deps {
+			printTask(dep, indent+1)
+		}
+	}
+
+	for _, t := range tasks {
+		printTask(t, 0)
+	}
+}
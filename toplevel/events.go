@@ -0,0 +1,163 @@
+package toplevel
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+// eventsSchemaVersion is incremented on incompatible changes of the event
+// stream schema
+const eventsSchemaVersion = 1
+
+// taskEvent is a single line of the event stream written by eventsReporter.
+//
+// The schema is stable: fields are only ever added, never removed or changed,
+// unless the version is incremented. Every event has the following fields:
+//
+//	v       schema version, currently 1
+//	event   event type, see below
+//	time    time of the event, RFC 3339 with nanoseconds
+//	id      task ID
+//	name    task name
+//
+// Event types and their specific fields:
+//
+//	started        the task has started
+//	dependencies   the task waits for subtasks
+//	               deps: IDs of subtasks
+//	               sequential: true if subtasks are run one after another
+//	output         the task has written a line of output
+//	               stream: "stdout" or "stderr"
+//	               line: the line without the trailing newline
+//	pool_waiting   the task waits for a slot in a resource pool
+//	               pool: name of the pool
+//	pool_acquired  the task has got a slot in a resource pool
+//	               pool: name of the pool
+//	retrying       the task is being retried after a failed attempt
+//	               attempt: number of the upcoming attempt, 2 or more
+//	               error: the error the previous attempt failed with
+//	finished       the task has finished
+//	               status: "succeeded", "cached" (results restored from the
+//	                       cache), "skipped" (outputs up to date), "failed",
+//	                       "cancelled" or "timedout"
+//	               error: the error the task failed with, if any
+//	               duration: total duration of the task, in seconds
+//	               self: duration of the task excluding waiting for
+//	                     subtasks, in seconds
+//	               attempts: number of attempts made to run the task
+type taskEvent struct {
+	Version    int       `json:"v"`
+	Event      string    `json:"event"`
+	Time       time.Time `json:"time"`
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Deps       []int     `json:"deps,omitempty"`
+	Sequential bool      `json:"sequential,omitempty"`
+	Stream     string    `json:"stream,omitempty"`
+	Line       *string   `json:"line,omitempty"`
+	Pool       string    `json:"pool,omitempty"`
+	Attempt    int       `json:"attempt,omitempty"`
+	Status     string    `json:"status,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Duration   *float64  `json:"duration,omitempty"`
+	Self       *float64  `json:"self,omitempty"`
+	Attempts   int       `json:"attempts,omitempty"`
+}
+
+// eventsReporter writes task events as newline-delimited JSON
+type eventsReporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newEventsReporter(w io.Writer) *eventsReporter {
+	return &eventsReporter{enc: json.NewEncoder(w)}
+}
+
+func (er *eventsReporter) emit(event string, t *task.Task, time time.Time, ev taskEvent) {
+	ev.Version = eventsSchemaVersion
+	ev.Event = event
+	ev.Time = time
+	ev.ID = t.ID
+	ev.Name = t.Name()
+
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	if err := er.enc.Encode(ev); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write event: %v\n", err)
+	}
+}
+
+func (er *eventsReporter) Started(t *task.Task) {
+	er.emit("started", t, time.Now(), taskEvent{})
+}
+
+func (er *eventsReporter) Dependencies(dependent *task.Task, dependees []*task.Task, sequential bool) {
+	deps := make([]int, 0, len(dependees))
+	for _, d := range dependees {
+		deps = append(deps, d.ID)
+	}
+	er.emit("dependencies", dependent, time.Now(), taskEvent{Deps: deps, Sequential: sequential})
+}
+
+func (er *eventsReporter) OutputLine(t *task.Task, time time.Time, line task.LogLine) {
+	stream := "stdout"
+	if line.Stream == task.StderrStream {
+		stream = "stderr"
+	}
+	text := strings.TrimSuffix(line.Line, "\n")
+	er.emit("output", t, time, taskEvent{Stream: stream, Line: &text})
+}
+
+func (er *eventsReporter) PoolWaiting(t *task.Task, pool *task.Pool) {
+	er.emit("pool_waiting", t, time.Now(), taskEvent{Pool: pool.Name()})
+}
+
+func (er *eventsReporter) PoolAcquired(t *task.Task, pool *task.Pool) {
+	er.emit("pool_acquired", t, time.Now(), taskEvent{Pool: pool.Name()})
+}
+
+func (er *eventsReporter) Retrying(t *task.Task, attempt int, err error) {
+	er.emit("retrying", t, time.Now(), taskEvent{Attempt: attempt, Error: err.Error()})
+}
+
+func (er *eventsReporter) Finished(t *task.Task) {
+	dur := t.Duration().Seconds()
+	self := t.SelfDuration().Seconds()
+	ev := taskEvent{
+		Status:   t.Status(),
+		Duration: &dur,
+		Self:     &self,
+		Attempts: t.Attempts(),
+	}
+	if t.Error != nil {
+		ev.Error = t.Error.Error()
+	}
+	er.emit("finished", t, t.End(), ev)
+}
+
+// openEventsFile opens the destination of the event stream: either a file
+// path, or "fd:N" for an already open file descriptor
+func openEventsFile(dest string) (*os.File, error) {
+	if fd := strings.TrimPrefix(dest, "fd:"); fd != dest {
+		n, err := strconv.Atoi(fd)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file descriptor %q", fd)
+		}
+		return os.NewFile(uintptr(n), dest), nil
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return nil, err
+	}
+	return os.Create(dest)
+}
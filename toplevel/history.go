@@ -0,0 +1,130 @@
+package toplevel
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ridge/game/mg"
+	"github.com/ridge/game/task"
+)
+
+const (
+	// regressionFactor is how many times slower than its median a task has to
+	// be to get a warning
+	regressionFactor = 1.5
+	// regressionMinDelta is how much slower than its median a task has to be to
+	// get a warning, so that jitter of quick tasks is not reported
+	regressionMinDelta = 250 * time.Millisecond
+	// regressionMinRuns is the number of the recent runs of a task needed to
+	// tell whether it has become slower
+	regressionMinRuns = 3
+)
+
+// historyFile returns the file with the history of the tasks run in the current
+// directory, or an empty string if there is no place for it, e.g. if $HOME is
+// not set
+func historyFile() string {
+	cacheDir := mg.CacheDir()
+	dir, err := os.Getwd()
+	if err != nil || !filepath.IsAbs(cacheDir) {
+		return ""
+	}
+	return filepath.Join(cacheDir, mg.HistoryCacheDir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(dir))))
+}
+
+// loadHistory returns the history of the tasks run in the current directory,
+// or nil if timings of the tasks are not recorded
+func loadHistory(logger *log.Logger) *task.History {
+	file := historyFile()
+	if file == "" {
+		return nil
+	}
+	history, err := task.LoadHistory(file)
+	if err != nil {
+		logger.Printf("Ignoring task history: %v\n", err)
+		return task.NewHistory(file)
+	}
+	return history
+}
+
+// findHistory returns the name of the task in the history, matching the name
+// given by the user case-insensitively
+func findHistory(history *task.History, name string) (string, bool) {
+	var found []string
+	for _, n := range history.Names() {
+		if n == name {
+			return n, true
+		}
+		if strings.EqualFold(n, name) {
+			found = append(found, n)
+		}
+	}
+	if len(found) != 1 {
+		return "", false
+	}
+	return found[0], true
+}
+
+// printHistory prints the timings of the recent runs of the task
+func printHistory(history *task.History, name string) error {
+	if history == nil {
+		return fmt.Errorf("No timings of task %s recorded", name)
+	}
+	found, ok := findHistory(history, name)
+	if !ok {
+		return fmt.Errorf("No timings of task %s recorded", name)
+	}
+	name = found
+
+	timings := history.Timings(name)
+	fmt.Printf("Recent timings of %s:\n", name)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+	for _, timing := range timings {
+		fmt.Fprintf(w, "  %s\t%.02fs\n", timing.Time.Local().Format("2006-01-02 15:04:05"), timing.Duration.Seconds())
+	}
+	w.Flush()
+	median, runs := history.Median(name)
+	fmt.Printf("Median %.02fs over %d %s\n", median.Seconds(), runs, plural("run", runs))
+	return nil
+}
+
+// warnRegressions warns about the tasks that have been significantly slower
+// than the median of their recent runs
+func warnRegressions(history *task.History, tasks []*task.Task) {
+	sorted := append([]*task.Task(nil), tasks...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].ID < sorted[j].ID
+	})
+	for _, t := range sorted {
+		if len(t.Spans) == 0 || t.Error != nil || t.Cached || t.UpToDate {
+			continue
+		}
+		median, runs := history.Median(t.Name())
+		if runs < regressionMinRuns || median <= 0 {
+			continue
+		}
+		d := t.SelfDuration()
+		if float64(d) < float64(median)*regressionFactor || d-median < regressionMinDelta {
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "warning: %s took %.02fs, %.01fx its median of %.02fs over the last %d runs\n",
+			t.Name(), d.Seconds(), d.Seconds()/median.Seconds(), median.Seconds(), runs)
+	}
+}
+
+// recordHistory warns about tasks that have become slower and adds the
+// timings of the tasks to the history
+func recordHistory(history *task.History, tasks []*task.Task) {
+	warnRegressions(history, tasks)
+	history.Record(tasks)
+	if err := history.Save(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save task history: %v\n", err)
+	}
+}
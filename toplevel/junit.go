@@ -0,0 +1,153 @@
+package toplevel
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+// JUnit XML report, as understood by CI systems. Every task is a test case.
+// Only tasks that failed on their own are marked failed: tasks failed due to
+// failures of their subtasks are not, and cancelled tasks, tasks that never
+// ran or found their outputs up to date are marked skipped.
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+func junitTestCaseOf(t *task.Task, suite string) junitTestCase {
+	tc := junitTestCase{
+		Name:      t.Name(),
+		ClassName: suite,
+		Time:      junitSeconds(0),
+	}
+	if len(t.Spans) == 0 {
+		tc.Skipped = &junitSkipped{Message: "not run"}
+		return tc
+	}
+	tc.Time = junitSeconds(t.Duration())
+
+	out, errOut := strings.Builder{}, strings.Builder{}
+	for _, line := range t.Output {
+		if line.Stream == task.StderrStream {
+			errOut.WriteString(line.Line)
+		} else {
+			out.WriteString(line.Line)
+		}
+	}
+	tc.SystemOut = out.String()
+	tc.SystemErr = errOut.String()
+
+	if t.UpToDate {
+		tc.Skipped = &junitSkipped{Message: "up to date"}
+		return tc
+	}
+	if t.Error == nil {
+		return tc
+	}
+	if _, ok := t.Error.(task.SubtasksFailure); ok {
+		// Subtasks carry the failures themselves
+		return tc
+	}
+	msg := strings.TrimSuffix(t.Error.Error(), "\n")
+	if t.Cancelled {
+		tc.Skipped = &junitSkipped{Message: "cancelled: " + msg}
+		return tc
+	}
+	tc.Failure = &junitFailure{
+		Message: strings.SplitN(msg, "\n", 2)[0],
+		Type:    t.Status(),
+		Text:    msg,
+	}
+	return tc
+}
+
+func junitReport(name string, tasks []*task.Task) junitTestSuites {
+	suite := junitTestSuite{Name: name}
+	var start, end time.Time
+	for _, t := range tasks {
+		tc := junitTestCaseOf(t, name)
+		suite.Tests++
+		if tc.Failure != nil {
+			suite.Failures++
+		}
+		if tc.Skipped != nil {
+			suite.Skipped++
+		}
+		suite.Cases = append(suite.Cases, tc)
+
+		if len(t.Spans) == 0 {
+			continue
+		}
+		if start.IsZero() || t.Start().Before(start) {
+			start = t.Start()
+		}
+		if t.End().After(end) {
+			end = t.End()
+		}
+	}
+	suite.Time = junitSeconds(end.Sub(start))
+	if !start.IsZero() {
+		suite.Timestamp = start.Format("2006-01-02T15:04:05")
+	}
+	return junitTestSuites{
+		Name:     name,
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Skipped:  suite.Skipped,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+}
+
+func writeJUnit(file string, name string, tasks []*task.Task) error {
+	data, err := xml.MarshalIndent(junitReport(name, tasks), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, append([]byte(xml.Header), append(data, '\n')...), 0644)
+}
@@ -0,0 +1,131 @@
+package toplevel
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// group returns the name of the group the target is listed in: its import
+// alias and namespace, if any
+func (t Target) group() string {
+	var parts []string
+	if t.Import != "" {
+		parts = append(parts, t.Import)
+	}
+	if t.Namespace != "" {
+		parts = append(parts, t.Namespace)
+	}
+	return strings.Join(parts, ":")
+}
+
+// targetGroup is a group of targets listed together
+type targetGroup struct {
+	name    string // empty for targets outside of namespaces and imports
+	comment string
+	targets []Target
+}
+
+// groupTargets groups the targets, leaving out hidden ones unless all is set.
+// Targets outside of namespaces and imports come first, followed by groups
+// sorted by name.
+func groupTargets(targets []Target, all bool) []targetGroup {
+	var groups []targetGroup
+	index := map[string]int{}
+	for _, target := range targets {
+		if target.Hidden && !all {
+			continue
+		}
+		name := target.group()
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, targetGroup{name: name})
+		}
+		if groups[i].comment == "" {
+			groups[i].comment = target.NamespaceComment
+		}
+		groups[i].targets = append(groups[i].targets, target)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].name < groups[j].name
+	})
+	return groups
+}
+
+// filterGroup returns the targets in the group with the given name or in the
+// groups nested in it
+func filterGroup(targets []Target, name string) []Target {
+	name = strings.ToLower(strings.TrimSuffix(name, ":"))
+	var out []Target
+	for _, target := range targets {
+		group := strings.ToLower(target.group())
+		if group == name || strings.HasPrefix(group, name+":") {
+			out = append(out, target)
+		}
+	}
+	return out
+}
+
+// targetListJSON is the list of targets printed by -l -format=json
+type targetListJSON struct {
+	Description string       `json:"description,omitempty"`
+	Targets     []targetJSON `json:"targets"`
+}
+
+type targetJSON struct {
+	Name            string    `json:"name"`
+	Synopsis        string    `json:"synopsis"`
+	Comment         string    `json:"comment"`
+	Default         bool      `json:"default"`
+	Namespace       string    `json:"namespace,omitempty"`
+	Import          string    `json:"import,omitempty"` // alias of the package the target is imported from
+	Args            []argJSON `json:"args,omitempty"`
+	Aliases         []string  `json:"aliases,omitempty"`
+	Hidden          bool      `json:"hidden,omitempty"`
+	Deprecated      bool      `json:"deprecated,omitempty"`
+	DeprecationNote string    `json:"deprecationNote,omitempty"`
+}
+
+type argJSON struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// listTargetsJSON prints the targets as JSON for tools, including hidden ones
+// if all is set, and exits
+func listTargetsJSON(targets []Target, defaultTarget string, desc string, all bool) {
+	list := targetListJSON{Description: desc, Targets: []targetJSON{}}
+	for _, target := range targets {
+		if target.Hidden && !all {
+			continue
+		}
+		t := targetJSON{
+			Name:            target.Name,
+			Synopsis:        target.Synopsis,
+			Comment:         target.Comment,
+			Default:         target.Name == defaultTarget,
+			Namespace:       target.Namespace,
+			Import:          target.Import,
+			Aliases:         target.Aliases,
+			Hidden:          target.Hidden,
+			Deprecated:      target.Deprecated,
+			DeprecationNote: target.DeprecationNote,
+		}
+		for _, arg := range target.Args {
+			t.Args = append(t.Args, argJSON{Name: arg.Name, Type: arg.Type})
+		}
+		list.Targets = append(list.Targets, t)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(list); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode the list of targets: %v\n", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
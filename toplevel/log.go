@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ridge/game/task"
@@ -36,10 +37,21 @@ func (fr fileReporter) Dependencies(dependent *task.Task, dependees []*task.Task
 	fmt.Fprintf(fr.File, "%s %s %s -> %s\n", dependent.StringID(), op, dependent.Name(), strings.Join(s, ", "))
 }
 
+func (fr fileReporter) PoolWaiting(t *task.Task, pool *task.Pool) {
+	fmt.Fprintf(fr.File, "%s WAITING %s for %s\n", t.StringID(), t.Name(), pool.Name())
+}
+
+func (fr fileReporter) PoolAcquired(t *task.Task, pool *task.Pool) {
+	fmt.Fprintf(fr.File, "%s ACQUIRED %s %s\n", t.StringID(), t.Name(), pool.Name())
+}
+
+func (fr fileReporter) Retrying(t *task.Task, attempt int, err error) {
+	fmt.Fprintf(fr.File, "%s RETRYING %s attempt=%d\n", t.StringID(), t.Name(), attempt)
+}
+
 func (fr fileReporter) Finished(t *task.Task) {
-	tag := "SUCCEEDED"
+	tag := strings.ToUpper(t.Status())
 	if t.Error != nil {
-		tag = "FAILED"
 		msg := t.Error.Error()
 		if !strings.HasSuffix(msg, "\n") {
 			msg += "\n"
@@ -53,10 +65,54 @@ func (fr fileReporter) Finished(t *task.Task) {
 	}
 	dur := t.Duration()
 	self := t.SelfDuration()
-	fmt.Fprintf(fr.File, "%s %s %s time=%.02fs, self=%.02fs, subtasks=%.02fs\n",
-		t.StringID(), tag, t.Name(), dur.Seconds(), self.Seconds(), (dur - self).Seconds())
+	attempts := ""
+	if n := t.Attempts(); n > 1 {
+		attempts = fmt.Sprintf(", attempts=%d", n)
+	}
+	fmt.Fprintf(fr.File, "%s %s %s time=%.02fs, self=%.02fs, subtasks=%.02fs%s\n",
+		t.StringID(), tag, t.Name(), dur.Seconds(), self.Seconds(), (dur - self).Seconds(), attempts)
 }
 
 func (fr fileReporter) OutputLine(t *task.Task, time time.Time, line task.LogLine) {
 	fmt.Fprintf(fr.File, "%s %s", t.StringID(), formatLine(line))
 }
+
+type bufferedLine struct {
+	time time.Time
+	line task.LogLine
+}
+
+// groupedFileReporter is a fileReporter printing the output of each task as a
+// block once the task finishes, instead of interleaving the lines of tasks
+// running in parallel
+type groupedFileReporter struct {
+	fileReporter
+
+	mu     sync.Mutex
+	output map[int][]bufferedLine
+}
+
+func newGroupedFileReporter(file *os.File) *groupedFileReporter {
+	return &groupedFileReporter{
+		fileReporter: fileReporter{file},
+		output:       map[int][]bufferedLine{},
+	}
+}
+
+func (gr *groupedFileReporter) Finished(t *task.Task) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	for _, bl := range gr.output[t.ID] {
+		gr.fileReporter.OutputLine(t, bl.time, bl.line)
+	}
+	delete(gr.output, t.ID)
+	gr.fileReporter.Finished(t)
+}
+
+func (gr *groupedFileReporter) OutputLine(t *task.Task, time time.Time, line task.LogLine) {
+	gr.mu.Lock()
+	defer gr.mu.Unlock()
+
+	gr.output[t.ID] = append(gr.output[t.ID], bufferedLine{time: time, line: line})
+}
@@ -0,0 +1,331 @@
+package toplevel
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ridge/game/mg"
+	"github.com/ridge/game/task"
+)
+
+// otlpTimeout is the time to wait for the collector to accept the spans
+const otlpTimeout = 10 * time.Second
+
+// OTLP span kinds and status codes, see
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+type otlpValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+func otlpString(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: &value}}
+}
+
+func otlpBool(key string, value bool) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{BoolValue: &value}}
+}
+
+func otlpInt(key string, value int) otlpAttribute {
+	s := strconv.Itoa(value)
+	return otlpAttribute{Key: key, Value: otlpValue{IntValue: &s}}
+}
+
+type otlpLink struct {
+	TraceID string `json:"traceId"`
+	SpanID  string `json:"spanId"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Links             []otlpLink      `json:"links,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpScopeSpans struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResourceSpans struct {
+	Resource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	} `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+// otlpRequest is the body of an OTLP/HTTP request exporting spans in JSON
+// encoding
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+var traceParentRx = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// parseTraceParent returns the trace and the span IDs of a W3C traceparent
+// header, or false if it is malformed or has all-zero IDs
+func parseTraceParent(s string) (traceID, spanID string, ok bool) {
+	m := traceParentRx.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || strings.Trim(m[1], "0") == "" || strings.Trim(m[2], "0") == "" {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+func formatTraceParent(traceID, spanID string) string {
+	return "00-" + traceID + "-" + spanID + "-01"
+}
+
+// otlpEndpoint returns the URL to export spans to, or an empty string if no
+// collector has been configured
+func otlpEndpoint() string {
+	if endpoint := os.Getenv(mg.OTLPTracesEndpointEnv); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv(mg.OTLPEndpointEnv); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// otlpExporter is a reporter turning tasks into OpenTelemetry spans, exported
+// to a collector over OTLP/HTTP after the run. Each task is a span with a child
+// span for each span of its execution. Tasks are children of the first task
+// depending on them and are linked to the others, and the targets are children
+// of the span of the run.
+//
+// The run joins the trace given by $TRACEPARENT, if any, and $TRACEPARENT is
+// set for commands run by the tasks, so that nested runs join the trace too.
+type otlpExporter struct {
+	endpoint   string
+	binaryName string
+	targets    []string
+	parentID   string // span ID of the parent of the run, if it has joined a trace
+
+	mu      sync.Mutex
+	traceID string
+	runID   string // span ID of the run
+	start   time.Time
+	spanIDs map[*task.Task]string
+	parents map[*task.Task]*task.Task
+	links   map[*task.Task][]*task.Task
+}
+
+func newOTLPExporter(endpoint string, binaryName string, targets []string) *otlpExporter {
+	e := &otlpExporter{
+		endpoint:   endpoint,
+		binaryName: binaryName,
+		targets:    targets,
+	}
+	if traceID, spanID, ok := parseTraceParent(os.Getenv(mg.TraceParentEnv)); ok {
+		e.traceID = traceID
+		e.parentID = spanID
+	}
+	e.reset()
+	return e
+}
+
+func (e *otlpExporter) Started(t *task.Task) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	id := randomID(8)
+	e.spanIDs[t] = id
+	t.SetEnv(mg.TraceParentEnv, formatTraceParent(e.traceID, id))
+}
+
+func (e *otlpExporter) Finished(t *task.Task) {}
+
+func (e *otlpExporter) Dependencies(dependent *task.Task, dependees []*task.Task, sequential bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, dependee := range dependees {
+		if _, ok := e.parents[dependee]; ok {
+			e.links[dependee] = append(e.links[dependee], dependent)
+		} else {
+			e.parents[dependee] = dependent
+		}
+	}
+}
+
+func (e *otlpExporter) OutputLine(t *task.Task, tm time.Time, line task.LogLine) {}
+
+// reset starts a new run in watch mode. A new trace is started for it, unless
+// the run has joined a trace.
+func (e *otlpExporter) reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.parentID == "" {
+		e.traceID = randomID(16)
+	}
+	e.runID = randomID(8)
+	e.start = time.Now()
+	e.spanIDs = map[*task.Task]string{}
+	e.parents = map[*task.Task]*task.Task{}
+	e.links = map[*task.Task][]*task.Task{}
+
+	// Commands not run by tasks join the trace too
+	os.Setenv(mg.TraceParentEnv, formatTraceParent(e.traceID, e.runID))
+}
+
+// spans converts the tasks into spans
+func (e *otlpExporter) spans(tasks []*task.Task) []otlpSpan {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	run := otlpSpan{
+		TraceID:           e.traceID,
+		SpanID:            e.runID,
+		ParentSpanID:      e.parentID,
+		Name:              e.binaryName,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: otlpTime(e.start),
+		EndTimeUnixNano:   otlpTime(time.Now()),
+		Attributes:        []otlpAttribute{otlpString("game.targets", strings.Join(e.targets, " "))},
+		Status:            otlpStatus{Code: otlpStatusOK},
+	}
+	spans := []otlpSpan{run}
+
+	for _, t := range tasks {
+		id, ok := e.spanIDs[t]
+		if !ok || len(t.Spans) == 0 {
+			continue
+		}
+
+		span := otlpSpan{
+			TraceID:           e.traceID,
+			SpanID:            id,
+			ParentSpanID:      e.runID,
+			Name:              t.Name(),
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: otlpTime(t.Start()),
+			EndTimeUnixNano:   otlpTime(t.End()),
+			Attributes: []otlpAttribute{
+				otlpInt("game.task.id", t.ID),
+				otlpInt("game.task.attempts", t.Attempts()),
+				otlpBool("game.task.cached", t.Cached),
+				otlpBool("game.task.up_to_date", t.UpToDate),
+			},
+			Status: otlpStatus{Code: otlpStatusOK},
+		}
+		if parent, ok := e.spanIDs[e.parents[t]]; ok {
+			span.ParentSpanID = parent
+		}
+		for _, dependent := range e.links[t] {
+			if linked, ok := e.spanIDs[dependent]; ok {
+				span.Links = append(span.Links, otlpLink{TraceID: e.traceID, SpanID: linked})
+			}
+		}
+		if t.Error != nil {
+			span.Status = otlpStatus{Code: otlpStatusError, Message: t.Error.Error()}
+			if t.Cancelled {
+				span.Attributes = append(span.Attributes, otlpBool("game.task.cancelled", true))
+			}
+		}
+		spans = append(spans, span)
+
+		for _, s := range t.Spans {
+			name := "compute"
+			var links []otlpLink
+			if len(s.Subtasks) != 0 {
+				name = "wait"
+				for _, subtask := range s.Subtasks {
+					if linked, ok := e.spanIDs[subtask]; ok {
+						links = append(links, otlpLink{TraceID: e.traceID, SpanID: linked})
+					}
+				}
+			}
+			spans = append(spans, otlpSpan{
+				TraceID:           e.traceID,
+				SpanID:            randomID(8),
+				ParentSpanID:      id,
+				Name:              name,
+				Kind:              otlpSpanKindInternal,
+				StartTimeUnixNano: otlpTime(s.Start),
+				EndTimeUnixNano:   otlpTime(s.End),
+				Attributes:        []otlpAttribute{otlpInt("game.task.attempt", s.Attempt)},
+				Links:             links,
+			})
+		}
+	}
+	return spans
+}
+
+// export sends the spans of the tasks to the collector
+func (e *otlpExporter) export(tasks []*task.Task) error {
+	resource := otlpResourceSpans{}
+	resource.Resource.Attributes = []otlpAttribute{otlpString("service.name", e.binaryName)}
+	scope := otlpScopeSpans{Spans: e.spans(tasks)}
+	scope.Scope.Name = "github.com/ridge/game"
+	resource.ScopeSpans = []otlpScopeSpans{scope}
+
+	data, err := json.Marshal(otlpRequest{ResourceSpans: []otlpResourceSpans{resource}})
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: otlpTimeout}
+	resp, err := client.Post(e.endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
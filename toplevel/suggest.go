@@ -0,0 +1,174 @@
+package toplevel
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const maxSuggestions = 5
+
+// isPrefixOf reports whether the name is a prefix of the target name segment by
+// segment, e.g. "dep:up" is a prefix of "deploy:upload"
+func isPrefixOf(name string, targetName string) bool {
+	segments := strings.Split(strings.ToLower(name), ":")
+	targetSegments := strings.Split(strings.ToLower(targetName), ":")
+	if len(segments) != len(targetSegments) {
+		return false
+	}
+	for i := range segments {
+		if !strings.HasPrefix(targetSegments[i], segments[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// prefixMatches returns the targets the name is a prefix of. Hidden targets
+// are left out.
+func prefixMatches(targets []Target, name string) []Target {
+	var matches []Target
+	for _, target := range targets {
+		if !target.Hidden && isPrefixOf(name, target.Name) {
+			matches = append(matches, target)
+		}
+	}
+	return matches
+}
+
+// ambiguousTargetError is an error of a name that is a prefix of several
+// targets
+type ambiguousTargetError struct {
+	name    string
+	matches []Target
+}
+
+func (ate ambiguousTargetError) Error() string {
+	names := make([]string, 0, len(ate.matches))
+	for _, target := range ate.matches {
+		names = append(names, target.Name)
+	}
+	return fmt.Sprintf("Ambiguous target specified: %s matches %s", ate.name, strings.Join(names, ", "))
+}
+
+// resolveTarget finds the target by its name or, if prefix matching is
+// enabled, by an unambiguous prefix of its name. It returns nil if there is no
+// such target.
+func resolveTarget(targets []Target, name string, prefix bool) (*Target, error) {
+	if target := findTarget(targets, name); target != nil {
+		return target, nil
+	}
+	if !prefix {
+		return nil, nil
+	}
+	switch matches := prefixMatches(targets, name); len(matches) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &matches[0], nil
+	default:
+		return nil, ambiguousTargetError{name: name, matches: matches}
+	}
+}
+
+// editDistance returns the optimal string alignment distance between a and b:
+// the number of insertions, deletions, substitutions and transpositions of
+// adjacent characters needed to turn one into the other
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	d := make([][]int, len(ra)+1)
+	for i := range d {
+		d[i] = make([]int, len(rb)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(ra)][len(rb)]
+}
+
+func minInt(first int, rest ...int) int {
+	for _, v := range rest {
+		if v < first {
+			first = v
+		}
+	}
+	return first
+}
+
+// suggestTargets returns names of the targets the user might have meant by the
+// unknown name: targets with similar names, targets the name is a prefix of,
+// and namespaced targets whose last part is similar to the name. Hidden targets
+// are not suggested.
+func suggestTargets(targets []Target, name string) []string {
+	lowerName := strings.ToLower(name)
+	maxDistance := len(lowerName)/3 + 1
+
+	type suggestion struct {
+		name     string
+		distance int
+	}
+	var suggestions []suggestion
+	for _, target := range targets {
+		if target.Hidden {
+			continue
+		}
+		lowerTarget := strings.ToLower(target.Name)
+		distance := editDistance(lowerName, lowerTarget)
+		if !strings.Contains(lowerName, ":") {
+			segments := strings.Split(lowerTarget, ":")
+			distance = minInt(distance, editDistance(lowerName, segments[len(segments)-1]))
+		}
+		if isPrefixOf(name, target.Name) {
+			distance = 0
+		}
+		if distance <= maxDistance {
+			suggestions = append(suggestions, suggestion{name: target.Name, distance: distance})
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].distance < suggestions[j].distance
+	})
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	names := make([]string, 0, len(suggestions))
+	for _, s := range suggestions {
+		names = append(names, s.name)
+	}
+	return names
+}
+
+// unknownTargetsMessage formats the error about unknown targets along with
+// suggestions for each of them
+func unknownTargetsMessage(targets []Target, unknown []string) string {
+	msg := fmt.Sprintf("Unknown %s specified: %s\n", plural("target", len(unknown)), strings.Join(unknown, ", "))
+	for _, name := range unknown {
+		suggestions := suggestTargets(targets, name)
+		if len(suggestions) == 0 {
+			continue
+		}
+		if len(unknown) > 1 {
+			msg += name + ": "
+		}
+		if len(suggestions) == 1 {
+			msg += fmt.Sprintf("Did you mean %s?\n", suggestions[0])
+		} else {
+			msg += fmt.Sprintf("Did you mean one of %s?\n", strings.Join(suggestions, ", "))
+		}
+	}
+	return msg
+}
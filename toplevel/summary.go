@@ -0,0 +1,177 @@
+package toplevel
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+// summaryTopN is the number of the slowest tasks and the longest waits shown in
+// the summary
+const summaryTopN = 5
+
+// pathStep is a task on the critical path, nested in the task waiting for it
+type pathStep struct {
+	task  *task.Task
+	depth int
+}
+
+// blocker returns the subtask the span has waited for the longest, i.e. the one
+// that has finished last, or nil if the subtasks had finished before the span
+func blocker(span task.Span) *task.Task {
+	var last *task.Task
+	for _, subtask := range span.Subtasks {
+		if len(subtask.Spans) == 0 {
+			continue
+		}
+		if last == nil || subtask.End().After(last.End()) {
+			last = subtask
+		}
+	}
+	if last == nil || !last.End().After(span.Start) {
+		return nil
+	}
+	return last
+}
+
+// criticalPath returns the chain of tasks the task has waited for: its
+// blockers, the blockers of those, and so on, in order of time
+func criticalPath(t *task.Task, depth int, seen map[*task.Task]bool) []pathStep {
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	steps := []pathStep{{task: t, depth: depth}}
+	for _, span := range t.Spans {
+		if len(span.Subtasks) == 0 {
+			continue
+		}
+		if b := blocker(span); b != nil {
+			steps = append(steps, criticalPath(b, depth+1, seen)...)
+		}
+	}
+	return steps
+}
+
+// wait is the time a task has spent waiting for a single dependency after the
+// other dependencies it has waited for together had finished
+type wait struct {
+	task, dep *task.Task
+	duration  time.Duration
+}
+
+// singleDepWaits returns the waits of the tasks for their blockers, longest
+// first
+func singleDepWaits(tasks []*task.Task) []wait {
+	var waits []wait
+	for _, t := range tasks {
+		byDep := map[*task.Task]time.Duration{}
+		for _, span := range t.Spans {
+			b := blocker(span)
+			if b == nil {
+				continue
+			}
+			alone := span.Start
+			for _, subtask := range span.Subtasks {
+				if subtask != b && len(subtask.Spans) != 0 && subtask.End().After(alone) {
+					alone = subtask.End()
+				}
+			}
+			end := span.End
+			if b.End().Before(end) {
+				end = b.End()
+			}
+			if d := end.Sub(alone); d > 0 {
+				byDep[b] += d
+			}
+		}
+		for dep, d := range byDep {
+			waits = append(waits, wait{task: t, dep: dep, duration: d})
+		}
+	}
+	sort.Slice(waits, func(i, j int) bool {
+		return waits[i].duration > waits[j].duration
+	})
+	return waits
+}
+
+// printSummary prints where the time of running the targets went: the wall
+// and compute time, the critical path through the tasks, the slowest tasks,
+// and the tasks that have waited the longest for a single dependency
+func printSummary(targets []*task.Task, all []*task.Task) {
+	var tasks []*task.Task
+	for _, t := range all {
+		if len(t.Spans) != 0 {
+			tasks = append(tasks, t)
+		}
+	}
+	if len(tasks) == 0 {
+		return
+	}
+
+	var start, end time.Time
+	var compute time.Duration
+	for _, t := range tasks {
+		if start.IsZero() || t.Start().Before(start) {
+			start = t.Start()
+		}
+		if t.End().After(end) {
+			end = t.End()
+		}
+		compute += t.SelfDuration()
+	}
+	wall := end.Sub(start)
+
+	fmt.Println()
+	fmt.Println("Summary:")
+	parallelism := 0.0
+	if wall > 0 {
+		parallelism = compute.Seconds() / wall.Seconds()
+	}
+	fmt.Printf("  wall time %.02fs, compute time %.02fs, parallelism %.02fx\n",
+		wall.Seconds(), compute.Seconds(), parallelism)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
+	fmt.Fprintln(w, "\nCritical path:")
+	seen := map[*task.Task]bool{}
+	for _, t := range targets {
+		if len(t.Spans) == 0 {
+			continue
+		}
+		for _, step := range criticalPath(t, 0, seen) {
+			fmt.Fprintf(w, "  %s%s\tself=%.02fs\n", strings.Repeat("    ", step.depth), step.task.Name(),
+				step.task.SelfDuration().Seconds())
+		}
+	}
+	w.Flush()
+
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return tasks[i].SelfDuration() > tasks[j].SelfDuration()
+	})
+	if len(tasks) > summaryTopN {
+		tasks = tasks[:summaryTopN]
+	}
+	fmt.Fprintln(w, "\nSlowest tasks:")
+	for _, t := range tasks {
+		fmt.Fprintf(w, "  %s\t%.02fs\n", t.Name(), t.SelfDuration().Seconds())
+	}
+	w.Flush()
+
+	waits := singleDepWaits(all)
+	if len(waits) == 0 {
+		return
+	}
+	if len(waits) > summaryTopN {
+		waits = waits[:summaryTopN]
+	}
+	fmt.Println("\nLongest waits for a single dependency:")
+	for _, wt := range waits {
+		fmt.Printf("  %s waited %.02fs for %s\n", wt.task.Name(), wt.duration.Seconds(), wt.dep.Name())
+	}
+}
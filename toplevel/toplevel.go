@@ -35,12 +35,37 @@ func taskTail(t *task.Task) string {
 	return b.String()
 }
 
+// Arg is a typed command-line argument of a target
+type Arg struct {
+	Name string
+	Type string
+}
+
 // Target is one build target
 type Target struct {
 	Name     string
 	Fn       interface{}
 	Synopsis string
 	Comment  string
+	Args     []Arg
+	Aliases  []string
+
+	Namespace        string // namespace of the target, if any
+	NamespaceComment string // doc comment of the namespace
+	Import           string // alias of the package the target is imported from, if any
+
+	Hidden          bool   // omitted from the list of targets unless all targets are listed
+	Deprecated      bool   // running the target prints a warning
+	DeprecationNote string // e.g. "use build:all", appended to the warning
+}
+
+// Usage formats the target name followed by its arguments
+func (t Target) Usage() string {
+	s := t.Name
+	for _, arg := range t.Args {
+		s += " <" + arg.Name + ">"
+	}
+	return s
 }
 
 func plural(name string, count int) string {
@@ -77,22 +102,69 @@ func parseDuration(env string) time.Duration {
 	return d
 }
 
-func listTargets(targets []Target, defaultTarget string, desc string) {
+func parseInt(env string) int {
+	val := os.Getenv(env)
+	if val == "" {
+		return 0
+	}
+	i, err := strconv.Atoi(val)
+	if err != nil {
+		log.Printf("warning: environment variable %s is not a valid int value: %v", env, val)
+		return 0
+	}
+	return i
+}
+
+// deprecation returns the warning printed when the target is run
+func (t Target) deprecation() string {
+	msg := "target " + t.Name + " is deprecated"
+	if t.DeprecationNote != "" {
+		msg += ", " + t.DeprecationNote
+	}
+	return msg
+}
+
+// listTargets prints the targets, including hidden ones if all is set, and
+// exits. Targets are grouped by import alias and namespace, each group headed
+// by the doc comment of its namespace.
+func listTargets(targets []Target, defaultTarget string, desc string, all bool) {
 	if desc != "" {
 		fmt.Print(desc + "\n\n")
 	}
 
 	fmt.Println("Targets:")
 	w := tabwriter.NewWriter(os.Stdout, 0, 4, 4, ' ', 0)
-	for _, target := range targets {
-		mark := ""
-		if target.Name == defaultTarget {
-			mark = "*"
+	listedDefault := false
+	for i, group := range groupTargets(targets, all) {
+		if group.name != "" {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			if group.comment != "" {
+				fmt.Fprintf(w, "%s - %s\n", group.name, group.comment)
+			} else {
+				fmt.Fprintln(w, group.name)
+			}
+		}
+		for _, target := range group.targets {
+			mark := ""
+			if target.Name == defaultTarget {
+				mark = "*"
+				listedDefault = true
+			}
+			aliases := ""
+			switch len(target.Aliases) {
+			case 0:
+			case 1:
+				aliases = " (alias: " + target.Aliases[0] + ")"
+			default:
+				aliases = " (aliases: " + strings.Join(target.Aliases, ", ") + ")"
+			}
+			fmt.Fprintf(w, "  %s%s%s%s\t%s\n", target.Name, mark, strings.TrimPrefix(target.Usage(), target.Name), aliases, target.Synopsis)
 		}
-		fmt.Fprintf(w, "  %s%s\t%s\n", target.Name, mark, target.Synopsis)
 	}
 	w.Flush()
-	if defaultTarget != "" {
+	if listedDefault {
 		fmt.Println("\n* default target")
 	}
 	os.Exit(0)
@@ -105,6 +177,13 @@ func findTarget(haystack []Target, needle string) *Target {
 			return &target
 		}
 	}
+	for _, target := range haystack {
+		for _, alias := range target.Aliases {
+			if strings.ToLower(alias) == needle {
+				return &target
+			}
+		}
+	}
 	return nil
 }
 
@@ -125,11 +204,22 @@ func printFailures(t *task.Task) {
 	var printFailure func(t *task.Task, indent int)
 	printFailure = func(t *task.Task, indent int) {
 		strIndent := strings.Repeat("    ", indent)
-		prefix := fmt.Sprintf("%s%s failed", strIndent, t.String())
+		verb := "failed"
+		if _, ok := t.Error.(task.TimeoutError); ok {
+			verb = "timed out"
+		}
+		prefix := fmt.Sprintf("%s%s %s", strIndent, t.String(), verb)
 
 		if subErr, ok := t.Error.(task.SubtasksFailure); ok {
 			fmt.Printf("%s, caused by\n", prefix)
-			for _, subtask := range subErr {
+			// Only print root causes, unless all subtasks have been cancelled
+			causes := subErr.Failed()
+			if len(causes) == 0 {
+				causes = subErr
+			} else if cancelled := subErr.Cancelled(); len(cancelled) > 0 {
+				fmt.Printf("%s    (%d %s cancelled)\n", strIndent, len(cancelled), plural("subtask", len(cancelled)))
+			}
+			for _, subtask := range causes {
 				printFailure(subtask, indent+1)
 			}
 			return
@@ -152,44 +242,70 @@ const (
 	eventMeta      eventType = "M"
 	eventInstant   eventType = "I"
 	eventStartStop eventType = "X"
+	eventFlowStart eventType = "s"
+	eventFlowEnd   eventType = "f"
 )
 
 type eventScope string
 
 const (
 	scopeGlobal eventScope = "g"
+	scopeThread eventScope = "t"
 )
 
 type eventColor string
 
 const (
-	eventColorThreadStateRunning = "thread_state_running"
+	eventColorThreadStateRunning  = "thread_state_running"
+	eventColorThreadStateSleeping = "thread_state_sleeping"
 )
 
+// maxInstantNameLen limits the length of names of instant events for lines of
+// stderr. The whole line is kept in the arguments of the event.
+const maxInstantNameLen = 80
+
 //
 // See
 // https://docs.google.com/document/d/1CvAClvFfyA5R-PhYUmn5OOQtYMH4h6I0nSsKchNAySU
 // for the format and allowed combinations of keys/values
 //
 type event struct {
-	Name      string            `json:"name"`
-	Category  string            `json:"cat,omitempty"`
-	Type      eventType         `json:"ph"`
-	ProcessID int               `json:"pid"`
-	ThreadID  int               `json:"tid"`
-	Args      map[string]string `json:"args,omitempty"`
-	Timestamp int64             `json:"ts,omitempty"`
-	Scope     eventScope        `json:"s,omitempty"`
-	Duration  int64             `json:"dur,omitempty"`
-	ColorName eventColor        `json:"cname,omitempty"`
+	Name         string            `json:"name"`
+	Category     string            `json:"cat,omitempty"`
+	Type         eventType         `json:"ph"`
+	ProcessID    int               `json:"pid"`
+	ThreadID     int               `json:"tid"`
+	Args         map[string]string `json:"args,omitempty"`
+	Timestamp    int64             `json:"ts,omitempty"`
+	Scope        eventScope        `json:"s,omitempty"`
+	Duration     int64             `json:"dur,omitempty"`
+	ColorName    eventColor        `json:"cname,omitempty"`
+	ID           int               `json:"id,omitempty"` // connects the start and the end of a flow
+	BindingPoint string            `json:"bp,omitempty"`
 }
 
 func unixMicro(t time.Time) int64 {
 	return t.UnixNano() / 1000
 }
 
-func collectEvents() []event {
-	events := []event{}
+// collectEvents converts the tasks of the run to trace events. Every task is a
+// thread with compute and wait spans. Flows connect each wait span to the
+// subtasks it waits for.
+func collectEvents(tr *tracer) []event {
+	events := []event{{
+		Name: "process_name",
+		Type: eventMeta,
+		Args: map[string]string{
+			"name": tr.binaryName,
+		},
+	}, {
+		Name: "process_labels",
+		Type: eventMeta,
+		Args: map[string]string{
+			"labels": strings.Join(tr.targets, " "),
+		},
+	}}
+	flowID := 0
 	for _, task := range task.All.Tasks() {
 		events = append(events, event{
 			Name:     "thread_name",
@@ -198,7 +314,12 @@ func collectEvents() []event {
 			Args: map[string]string{
 				"name": task.String(),
 			},
-		}, event{
+		})
+		if len(task.Spans) == 0 {
+			// the task has never run
+			continue
+		}
+		events = append(events, event{
 			Name:      "start " + task.String(),
 			Type:      eventInstant,
 			Scope:     scopeGlobal,
@@ -212,33 +333,105 @@ func collectEvents() []event {
 			Timestamp: unixMicro(task.End()),
 		})
 		for _, span := range task.Spans {
-			if len(span.Subtasks) != 0 {
+			if len(span.Subtasks) == 0 {
+				events = append(events, event{
+					Name:      "compute",
+					Category:  "compute",
+					Type:      eventStartStop,
+					Timestamp: unixMicro(span.Start),
+					ThreadID:  task.ID,
+					Duration:  span.End.Sub(span.Start).Microseconds(),
+					ColorName: eventColorThreadStateRunning,
+				})
 				continue
 			}
 			events = append(events, event{
-				Name:      "compute",
-				Category:  "compute",
+				Name:      "wait",
+				Category:  "wait",
 				Type:      eventStartStop,
 				Timestamp: unixMicro(span.Start),
 				ThreadID:  task.ID,
 				Duration:  span.End.Sub(span.Start).Microseconds(),
-				ColorName: eventColorThreadStateRunning,
+				ColorName: eventColorThreadStateSleeping,
+			})
+			for _, subtask := range span.Subtasks {
+				// Arrows lead only to the subtasks started by this wait,
+				// subtasks started earlier by other tasks would get arrows
+				// back in time
+				if len(subtask.Spans) == 0 || subtask.Start().Before(span.Start) {
+					continue
+				}
+				flowID++
+				events = append(events, event{
+					Name:      "dep",
+					Category:  "dep",
+					Type:      eventFlowStart,
+					Timestamp: unixMicro(span.Start),
+					ThreadID:  task.ID,
+					ID:        flowID,
+				}, event{
+					Name:         "dep",
+					Category:     "dep",
+					Type:         eventFlowEnd,
+					Timestamp:    unixMicro(subtask.Start()),
+					ThreadID:     subtask.ID,
+					ID:           flowID,
+					BindingPoint: "e",
+				})
+			}
+		}
+		for _, line := range tr.stderrLines(task) {
+			text := strings.TrimSuffix(line.line, "\n")
+			name := text
+			if runes := []rune(name); len(runes) > maxInstantNameLen {
+				name = string(runes[:maxInstantNameLen]) + "..."
+			}
+			events = append(events, event{
+				Name:      name,
+				Category:  "stderr",
+				Type:      eventInstant,
+				Scope:     scopeThread,
+				ThreadID:  task.ID,
+				Timestamp: unixMicro(line.time),
+				Args: map[string]string{
+					"line": text,
+				},
 			})
 		}
 	}
 	return events
 }
 
-func run(ctx context.Context, tasks []*task.Task, tracingFile string) (exitCode int) {
-	if tracingFile != "" {
+// runOptions are the options of running the targets
+type runOptions struct {
+	binaryName string
+	tracer     *tracer       // nil unless tracing
+	otlp       *otlpExporter // nil unless exporting spans to an OpenTelemetry collector
+	junitFile  string
+	summary    bool
+	history    *task.History // nil unless the timings of the tasks are recorded
+}
+
+func run(ctx context.Context, tasks []*task.Task, opts runOptions) (exitCode int) {
+	if opts.junitFile != "" {
 		defer func() {
-			data, err := json.Marshal(collectEvents())
+			if err := writeJUnit(opts.junitFile, opts.binaryName, task.All.Tasks()); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to save JUnit report: %v\n", err)
+				exitCode = 1
+			}
+		}()
+	}
+
+	if tr := opts.tracer; tr != nil {
+		defer func() {
+			defer tr.reset()
+			data, err := json.Marshal(collectEvents(tr))
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Unexpected failure to encode JSON for tracing: %v\n", err)
 				exitCode = 1
 				return
 			}
-			if err := ioutil.WriteFile(tracingFile, data, 0644); err != nil {
+			if err := ioutil.WriteFile(tr.file, data, 0644); err != nil {
 				fmt.Fprintf(os.Stderr, "Failed to save tracing file: %v\n", err)
 				exitCode = 1
 				return
@@ -246,6 +439,27 @@ func run(ctx context.Context, tasks []*task.Task, tracingFile string) (exitCode
 		}()
 	}
 
+	if e := opts.otlp; e != nil {
+		defer func() {
+			defer e.reset()
+			if err := e.export(task.All.Tasks()); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to export spans to %s: %v\n", e.endpoint, err)
+			}
+		}()
+	}
+
+	if opts.history != nil {
+		defer func() {
+			recordHistory(opts.history, task.All.Tasks())
+		}()
+	}
+
+	if opts.summary {
+		defer func() {
+			printSummary(tasks, task.All.Tasks())
+		}()
+	}
+
 	defer func() {
 		if v := recover(); v != nil {
 			fmt.Printf("Unexpected error: %v\n", v)
@@ -268,9 +482,23 @@ func run(ctx context.Context, tasks []*task.Task, tracingFile string) (exitCode
 func Main(binaryName string, targets []Target, varTargets []Target, defaultTarget string, desc string, module string, usageConfig UsageConfig) {
 	verbose := false
 	list := false // print out a list of targets
+	listAll := false
+	listFormat := ""
 	help := false // request target help
 	var timeout time.Duration
 	tracing := ""
+	jobs := 0
+	failFast := false
+	dryRun := false
+	events := ""
+	junit := ""
+	summary := false
+	historyTask := ""
+	grouped := false
+	watch := false
+	completion := ""
+	completeTargets := false
+	prefix := false
 
 	fs := flag.FlagSet{}
 	fs.SetOutput(os.Stdout)
@@ -278,22 +506,63 @@ func Main(binaryName string, targets []Target, varTargets []Target, defaultTarge
 	// default flag set with ExitOnError and auto generated PrintDefaults should be sufficient
 	fs.BoolVar(&verbose, "v", parseBool("GAMEFILE_VERBOSE"), "show verbose output when running targets")
 	fs.BoolVar(&list, "l", parseBool("GAMEFILE_LIST"), "list targets for this binary")
+	fs.BoolVar(&listAll, "all", parseBool(mg.ListAllEnv), "list hidden targets too")
+	fs.StringVar(&listFormat, "format", os.Getenv(mg.ListFormatEnv), "format of the list of targets: text or json")
 	fs.BoolVar(&help, "h", parseBool("GAMEFILE_HELP"), "print out help for a specific target")
 	fs.DurationVar(&timeout, "t", parseDuration("GAMEFILE_TIMEOUT"), "timeout in duration parsable format (e.g. 5m30s)")
 	fs.StringVar(&tracing, "trace", os.Getenv("GAMEFILE_TRACE"), "trace task execution and save to the given file in Chrome trace_event format")
+	fs.IntVar(&jobs, "j", parseInt(mg.JobsEnv), "limit the number of tasks running simultaneously (0 means no limit)")
+	fs.BoolVar(&failFast, "fail-fast", parseBool(mg.FailFastEnv), "cancel remaining tasks as soon as one of them fails")
+	fs.StringVar(&events, "events", os.Getenv(mg.EventsEnv), "write task events as newline-delimited JSON to the given file or fd:N")
+	fs.StringVar(&junit, "junit", os.Getenv(mg.JUnitEnv), "save results of tasks to the given file in JUnit XML format")
+	fs.BoolVar(&summary, "summary", parseBool(mg.SummaryEnv), "print the critical path and the slowest tasks after running the targets")
+	fs.StringVar(&historyTask, "history", os.Getenv(mg.HistoryEnv), "print timings of the recent runs of the given task")
+	fs.BoolVar(&grouped, "grouped", parseBool(mg.GroupedOutputEnv), "print the output of each task as a block once it finishes")
+	fs.BoolVar(&watch, "w", parseBool(mg.WatchEnv), "run the targets again when files they depend on change")
+	fs.StringVar(&completion, "completion", "", "print a shell completion script for bash, zsh or fish")
+	fs.BoolVar(&completeTargets, "complete-targets", parseBool(mg.CompleteTargetsEnv), "")
+	fs.BoolVar(&prefix, "prefix", parseBool(mg.PrefixEnv), "run targets given by unambiguous prefixes of their names")
+	fs.BoolVar(&dryRun, "n", parseBool(mg.DryRunEnv), "print the graph of tasks instead of running them")
+	fs.BoolVar(&dryRun, "dry-run", parseBool(mg.DryRunEnv), "print the graph of tasks instead of running them")
 	fs.Usage = func() {
 		fmt.Fprintf(os.Stdout, `
 %s [options] [target]
 
 Commands:
-  -l    list targets in this binary
+  -completion <string>
+        print a shell completion script for bash, zsh or fish
+  -l [namespace]
+        list targets in this binary, or only those in the given namespace
+  -l -all
+        list targets in this binary, including hidden ones
+  -l -format <string>
+        list targets in the given format: text (default) or json
   -h    show this help
+  -history <string>
+        print timings of the recent runs of the given task
+  -n, -dry-run
+        print the graph of tasks for the targets instead of running them
 
 Options:
+  -events <string>
+        write task events as newline-delimited JSON to the given file or fd:N
+  -fail-fast
+        cancel remaining tasks as soon as one of them fails
+  -grouped
+        print the output of each task as a block once it finishes
   -h    show description of a target
+  -j <int>
+        limit the number of tasks running simultaneously (0 means no limit)
+  -junit <string>
+        save results of tasks to the given file in JUnit XML format
+  -prefix
+        run targets given by unambiguous prefixes of their names (e.g. dep:up for deploy:upload)
+  -summary
+        print the critical path and the slowest tasks after running the targets
   -t <string>
         timeout in duration parsable format (e.g. 5m30s)
   -v    show verbose output when running targets
+  -w    run the targets again when files they depend on change
  `[1:], filepath.Base(os.Args[0]))
 	}
 	if err := fs.Parse(os.Args[1:]); err != nil {
@@ -307,6 +576,22 @@ Options:
 		os.Exit(0)
 	}
 
+	if completion != "" {
+		script, err := CompletionScript(completion, filepath.Base(os.Args[0]), CompletionFlags(&fs, map[string]string{
+			"completion": "bash zsh fish",
+			"events":     "file",
+			"format":     "text json",
+			"junit":      "file",
+			"trace":      "file",
+		}))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		fmt.Print(script)
+		os.Exit(0)
+	}
+
 	log.SetFlags(0)
 	if !verbose {
 		log.SetOutput(ioutil.Discard)
@@ -322,15 +607,56 @@ Options:
 		return targets[i].Name < targets[j].Name
 	})
 
+	if completeTargets {
+		listTargetNames(targets)
+		os.Exit(0)
+	}
+
 	if list {
-		listTargets(targets, defaultTarget, desc)
+		if len(args) > 0 {
+			targets = filterGroup(targets, args[0])
+			if len(targets) == 0 {
+				logger.Printf("No targets in namespace %s\n", args[0])
+				os.Exit(2)
+			}
+		}
+		switch listFormat {
+		case "", "text":
+			listTargets(targets, defaultTarget, desc, listAll)
+		case "json":
+			listTargetsJSON(targets, defaultTarget, desc, listAll)
+		default:
+			logger.Printf("Unknown list format %q, must be text or json\n", listFormat)
+			os.Exit(2)
+		}
 	}
 
 	task.SetModule(module)
 
+	// Deprecated targets warn when run as dependencies of other targets too
+	for _, target := range targets {
+		if target.Deprecated && len(target.Args) == 0 {
+			task.All.Deprecate(target.Fn, target.deprecation())
+		}
+	}
+
+	task.SetJobs(jobs)
+	task.SetFailFast(failFast)
+	task.SetCacheDir(filepath.Join(mg.CacheDir(), mg.TasksCacheDir))
+
+	history := loadHistory(logger)
+
+	if historyTask != "" {
+		if err := printHistory(history, historyTask); err != nil {
+			logger.Println(err)
+			os.Exit(2)
+		}
+		os.Exit(0)
+	}
+
 	var haveReporter bool
 	if _, disableTTY := os.LookupEnv(mg.NoTTYEnv); !disableTTY {
-		ttyReporter, err := tty.NewReporter()
+		ttyReporter, err := tty.NewReporter(history, grouped)
 		if err == nil {
 			task.AddReporter(ttyReporter)
 			haveReporter = true
@@ -339,7 +665,11 @@ Options:
 
 	// Always fall back to non-TTY reporter
 	if !haveReporter {
-		task.AddReporter(fileReporter{os.Stdout})
+		if grouped {
+			task.AddReporter(newGroupedFileReporter(os.Stdout))
+		} else {
+			task.AddReporter(fileReporter{os.Stdout})
+		}
 	}
 
 	if logFile, ok := os.LookupEnv("GAMEFILE_LOGFILE"); ok {
@@ -358,42 +688,106 @@ Options:
 		fmt.Printf("Log file: %s\n", logFile)
 	}
 
+	if events != "" {
+		fh, err := openEventsFile(events)
+		if err != nil {
+			fmt.Printf("Failed to open events file %s: %v\n", events, err)
+			os.Exit(1)
+		}
+		defer fh.Close()
+		task.AddReporter(newEventsReporter(fh))
+	}
+
 	if len(args) == 0 {
 		if defaultTarget != "" {
 			ignoreDefault, _ := strconv.ParseBool(os.Getenv("GAMEFILE_IGNOREDEFAULT"))
 			if ignoreDefault {
-				listTargets(targets, defaultTarget, desc)
+				listTargets(targets, defaultTarget, desc, listAll)
 			} else {
 				args = []string{defaultTarget}
 			}
 		} else {
-			listTargets(targets, defaultTarget, desc)
+			listTargets(targets, defaultTarget, desc, listAll)
 		}
 	}
 
-	unknown := []string{}
-	for _, arg := range args {
-		if findTarget(targets, arg) == nil {
-			unknown = append(unknown, arg)
+	if help {
+		target, err := resolveTarget(targets, args[0], prefix)
+		if err != nil {
+			logger.Println(err)
+			os.Exit(2)
+		}
+		if target == nil {
+			logger.Print(unknownTargetsMessage(targets, args[:1]))
+			os.Exit(2)
+		}
+		fmt.Printf("%s %s:\n\n", binaryName, target.Name)
+		if target.Comment != "" {
+			fmt.Print(target.Comment + "\n\n")
+		}
+		if len(target.Args) > 0 {
+			fmt.Printf("Usage:\n\n\t%s %s\n\n", binaryName, target.Usage())
+		}
+		switch len(target.Aliases) {
+		case 0:
+		case 1:
+			fmt.Printf("Alias: %s\n\n", target.Aliases[0])
+		default:
+			fmt.Printf("Aliases: %s\n\n", strings.Join(target.Aliases, ", "))
 		}
+		if target.Deprecated {
+			fmt.Printf("Deprecated: %s\n\n", target.deprecation())
+		}
+		os.Exit(0)
+	}
+
+	calls, unknown, err := parseTargetCalls(targets, args, prefix)
+	if err != nil {
+		logger.Println(err)
+		os.Exit(2)
 	}
 	if len(unknown) > 0 {
-		logger.Printf("Unknown %s specified: %s\n", plural("target", len(unknown)),
-			strings.Join(unknown, ", "))
+		logger.Print(unknownTargetsMessage(targets, unknown))
 		os.Exit(2)
 	}
 
-	if help {
-		target := findTarget(targets, args[0])
-		fmt.Printf("%s %s:\n\n", binaryName, target.Name)
-		if target.Comment != "" {
-			fmt.Print(target.Comment + "\n\n")
+	targetFns := []interface{}{}
+	targetNames := []string{}
+	for _, call := range calls {
+		fn, err := call.fn()
+		if err != nil {
+			logger.Println(err)
+			os.Exit(2)
 		}
+		if call.target.Deprecated && len(call.target.Args) > 0 {
+			// Targets with arguments are different tasks for each invocation
+			task.All.Deprecate(fn, call.target.deprecation())
+		}
+		targetFns = append(targetFns, fn)
+		targetNames = append(targetNames, call.target.Name)
+	}
+
+	if dryRun {
+		printPlan(task.All.Register(targetFns))
 		os.Exit(0)
 	}
 
 	if usageConfig.StateFile != "" {
-		processUsage(usageConfig, args)
+		processUsage(usageConfig, targetNames)
+	}
+
+	opts := runOptions{binaryName: binaryName, junitFile: junit, summary: summary, history: history}
+	if tracing != "" {
+		opts.tracer = newTracer(tracing, binaryName, targetNames)
+		task.AddReporter(opts.tracer)
+	}
+	if endpoint := otlpEndpoint(); endpoint != "" {
+		opts.otlp = newOTLPExporter(endpoint, binaryName, targetNames)
+		task.AddReporter(opts.otlp)
+	}
+
+	if watch {
+		os.Exit(runWatching(context.Background(), targetFns, timeout, opts))
 	}
 
 	ctx := context.Background()
@@ -403,13 +797,7 @@ Options:
 		defer cancel()
 	}
 
-	targetFns := []interface{}{}
-	for _, targetName := range args {
-		target := findTarget(targets, strings.ToLower(targetName))
-		targetFns = append(targetFns, target.Fn)
-	}
-
 	tasks := task.All.Register(targetFns)
 
-	os.Exit(run(ctx, tasks, tracing))
+	os.Exit(run(ctx, tasks, opts))
 }
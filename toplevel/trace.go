@@ -0,0 +1,67 @@
+package toplevel
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+// tracedLine is a line of stderr of a task shown in the trace
+type tracedLine struct {
+	time time.Time
+	line string
+}
+
+// tracer is a reporter recording what tasks do not keep themselves, for the
+// trace of the run saved to file in Chrome trace_event format
+type tracer struct {
+	file       string
+	binaryName string
+	targets    []string
+
+	mu     sync.Mutex
+	stderr map[*task.Task][]tracedLine
+}
+
+func newTracer(file string, binaryName string, targets []string) *tracer {
+	return &tracer{
+		file:       file,
+		binaryName: binaryName,
+		targets:    targets,
+		stderr:     map[*task.Task][]tracedLine{},
+	}
+}
+
+func (tr *tracer) Started(t *task.Task) {}
+
+func (tr *tracer) Finished(t *task.Task) {}
+
+func (tr *tracer) Dependencies(dependent *task.Task, dependees []*task.Task, sequential bool) {}
+
+func (tr *tracer) OutputLine(t *task.Task, tm time.Time, line task.LogLine) {
+	if line.Stream != task.StderrStream {
+		return
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.stderr[t] = append(tr.stderr[t], tracedLine{time: tm, line: line.Line})
+}
+
+// stderrLines returns the lines of stderr of the task
+func (tr *tracer) stderrLines(t *task.Task) []tracedLine {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	return tr.stderr[t]
+}
+
+// reset forgets the recorded lines before the next run in watch mode
+func (tr *tracer) reset() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	tr.stderr = map[*task.Task][]tracedLine{}
+}
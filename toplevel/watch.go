@@ -0,0 +1,148 @@
+package toplevel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ridge/game/mg"
+	"github.com/ridge/game/task"
+)
+
+// watchDebounce is the time to wait after a change for more changes, so that a
+// burst of changes, e.g. from switching git branches, causes a single run
+const watchDebounce = 200 * time.Millisecond
+
+// debounce waits until no changes happen for watchDebounce after the first one
+func debounce(first string, changes <-chan string) string {
+	for {
+		select {
+		case _, ok := <-changes:
+			if !ok {
+				return first
+			}
+		case <-time.After(watchDebounce):
+			return first
+		}
+	}
+}
+
+// WaitForChange waits until any of the files or directories changes and returns
+// the changed path. It is used to wait for broken gamefiles to be fixed in watch
+// mode.
+func WaitForChange(paths []string) (string, error) {
+	w, err := newWatcher()
+	if err != nil {
+		return "", err
+	}
+	defer w.close()
+	if err := w.add(paths); err != nil {
+		return "", err
+	}
+	return debounce(<-w.changes, w.changes), nil
+}
+
+// watchPaths returns the files and directories declared by the tasks of the
+// last run
+func watchPaths() []string {
+	var paths []string
+	for _, t := range task.All.Tasks() {
+		paths = append(paths, t.WatchPaths()...)
+	}
+	return paths
+}
+
+// outputPaths returns the files and directories written by the tasks of the
+// last run, whose changes are not watched
+func outputPaths() []string {
+	var paths []string
+	for _, t := range task.All.Tasks() {
+		paths = append(paths, t.OutputPaths()...)
+	}
+	return paths
+}
+
+// gamefiles returns the absolute paths of the files whose changes require
+// rebuilding the binary
+func gamefiles() map[string]bool {
+	files := map[string]bool{}
+	for _, file := range filepath.SplitList(os.Getenv(mg.WatchFilesEnv)) {
+		if abs, err := filepath.Abs(file); err == nil {
+			files[abs] = true
+		}
+	}
+	return files
+}
+
+// runWatching runs the targets, and runs them again once gamefiles or files
+// declared by the tasks change, cancelling the run in progress. It returns
+// mg.WatchRebuildExitCode once gamefiles change.
+func runWatching(ctx context.Context, targetFns []interface{}, timeout time.Duration, opts runOptions) int {
+	rebuild := gamefiles()
+	var extra []string
+	for file := range rebuild {
+		extra = append(extra, file)
+	}
+
+	// Outputs of the tasks are not watched, or tasks writing under the paths
+	// they watch would keep cancelling their own runs
+	var watched, outputs []string
+	for {
+		w, err := newWatcher()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to watch files: %v\n", err)
+			return 1
+		}
+		if err := w.ignore(outputs); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to watch files: %v\n", err)
+		}
+		if err := w.add(append(extra, watched...)); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to watch files: %v\n", err)
+		}
+
+		var runCtx context.Context
+		var cancel context.CancelFunc
+		if timeout != 0 {
+			runCtx, cancel = context.WithTimeout(ctx, timeout)
+		} else {
+			runCtx, cancel = context.WithCancel(ctx)
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			run(runCtx, task.All.Register(targetFns), opts)
+		}()
+
+		var changed string
+		select {
+		case <-done:
+			watched, outputs = watchPaths(), outputPaths()
+			if err := w.ignore(outputs); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to watch files: %v\n", err)
+			}
+			if err := w.add(watched); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to watch files: %v\n", err)
+			}
+			fmt.Println("Watching for changes...")
+			changed = debounce(<-w.changes, w.changes)
+		case changed = <-w.changes:
+			cancel()
+			<-done
+			changed = debounce(changed, w.changes)
+		}
+		cancel()
+		w.close()
+		task.All.Reset()
+
+		if changed == "" {
+			changed = "Files"
+		}
+		if rebuild[changed] {
+			fmt.Printf("%s changed, rebuilding\n", changed)
+			return mg.WatchRebuildExitCode
+		}
+		fmt.Printf("%s changed, running again\n", changed)
+	}
+}
@@ -0,0 +1,188 @@
+//go:build linux
+
+package toplevel
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const watchMask = unix.IN_ATTRIB | unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE |
+	unix.IN_MODIFY | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// watcher watches files and directories using inotify. Files are watched
+// through their parent directories, so that replacing a file is noticed too.
+type watcher struct {
+	file    *os.File
+	changes chan string
+
+	mu    sync.Mutex
+	dirs  map[int]string             // watch descriptor -> directory
+	trees map[string]bool            // directories watched as a whole, recursively
+	names map[string]map[string]bool // directory -> names of watched files in it
+	// absolute paths and glob patterns of files and directories whose changes
+	// are ignored, along with changes to anything under them
+	ignored []string
+}
+
+func newWatcher() (*watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &watcher{
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		changes: make(chan string, 1),
+		dirs:    map[int]string{},
+		trees:   map[string]bool{},
+		names:   map[string]map[string]bool{},
+	}
+	go w.read()
+	return w, nil
+}
+
+// add watches the paths. Directories are watched recursively, skipping hidden
+// ones. Missing paths are watched for creation.
+func (w *watcher) add(paths []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			if err := w.addTree(path); err != nil {
+				return err
+			}
+			continue
+		}
+		dir, name := filepath.Split(path)
+		dir = filepath.Clean(dir)
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		if err := w.addDir(dir); err != nil {
+			return err
+		}
+		if w.names[dir] == nil {
+			w.names[dir] = map[string]bool{}
+		}
+		w.names[dir][name] = true
+	}
+	return nil
+}
+
+// ignore ignores changes to the paths, given as paths or filepath.Glob patterns,
+// and to anything under them
+func (w *watcher) ignore(paths []string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, path := range paths {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+		w.ignored = append(w.ignored, path)
+	}
+	return nil
+}
+
+// isIgnored tells whether the path or any of its parent directories is ignored
+func (w *watcher) isIgnored(path string) bool {
+	for _, ignored := range w.ignored {
+		for p := path; ; p = filepath.Dir(p) {
+			if matched, _ := filepath.Match(ignored, p); matched || p == ignored {
+				return true
+			}
+			if p == filepath.Dir(p) {
+				break
+			}
+		}
+	}
+	return false
+}
+
+func (w *watcher) addTree(root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() {
+			return err
+		}
+		if path != root && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		w.trees[path] = true
+		return w.addDir(path)
+	})
+}
+
+func (w *watcher) addDir(dir string) error {
+	wd, err := unix.InotifyAddWatch(int(w.file.Fd()), dir, watchMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	w.dirs[wd] = dir
+	return nil
+}
+
+// changed returns the path of a watched file changed by the event, or false if
+// the event is not interesting
+func (w *watcher) changed(event *unix.InotifyEvent, name string) (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+		return "", true
+	}
+	dir, ok := w.dirs[int(event.Wd)]
+	if !ok || name == "" {
+		return "", false
+	}
+	if !w.names[dir][name] && (!w.trees[dir] || strings.HasPrefix(name, ".")) {
+		return "", false
+	}
+	path := filepath.Join(dir, name)
+	if w.isIgnored(path) {
+		return "", false
+	}
+	if w.trees[dir] && event.Mask&unix.IN_ISDIR != 0 && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+		w.addTree(path) // the directory may have already gone
+	}
+	return path, true
+}
+
+func (w *watcher) read() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			close(w.changes)
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			start := offset + unix.SizeofInotifyEvent
+			offset = start + int(event.Len)
+			name := strings.TrimRight(string(buf[start:offset]), "\x00")
+
+			if path, ok := w.changed(event, name); ok {
+				select {
+				case w.changes <- path:
+				default:
+					// a change is already pending
+				}
+			}
+		}
+	}
+}
+
+func (w *watcher) close() {
+	w.file.Close()
+}
@@ -0,0 +1,26 @@
+//go:build !linux
+
+package toplevel
+
+import (
+	"errors"
+)
+
+type watcher struct {
+	changes chan string
+}
+
+func newWatcher() (*watcher, error) {
+	return nil, errors.New("watch mode is only available under Linux")
+}
+
+func (w *watcher) add(paths []string) error {
+	return nil
+}
+
+func (w *watcher) ignore(paths []string) error {
+	return nil
+}
+
+func (w *watcher) close() {
+}
@@ -8,6 +8,6 @@ import (
 	"github.com/ridge/game/task"
 )
 
-func NewReporter() (task.Reporter, error) {
+func NewReporter(history *task.History, grouped bool) (task.Reporter, error) {
 	return nil, fmt.Errorf("TTY reporter is only available under Unix")
 }
@@ -4,6 +4,7 @@ package tty
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/signal"
 	"sort"
@@ -26,11 +27,25 @@ const (
 	defColor         = "\x1b[0m"
 )
 
+// maxLastLineLen is the number of characters of the last line of output of a
+// running task shown in the tasks line in grouped mode
+const maxLastLineLen = 40
+
 type Reporter struct {
 	mu         sync.Mutex
 	termCols   int
 	unfinished map[int]string
 	deps       depSet
+	waiting    map[int]bool // tasks waiting for a pool slot
+
+	history   *task.History         // nil if estimates are not shown
+	estimates map[int]time.Duration // median durations of the running tasks
+	computed  map[int]time.Duration // time the running tasks have spent computing
+	computing map[int]time.Time     // the time the tasks that are computing now started to
+
+	grouped   bool                   // print output of each task as a block once it finishes
+	output    map[int][]task.LogLine // output of the unfinished tasks in grouped mode
+	lastLines map[int]string         // last non-empty lines of output of the unfinished tasks in grouped mode
 }
 
 // Tasks line format:
@@ -43,10 +58,17 @@ type Reporter struct {
 // If the terminal is too narrow to display all unfinished tasks, then
 // first blocked tasks are clipped, then running tasks' names are
 // removed and finally running tasks are clipped.
+//
+// Names of running tasks are followed by the estimated time left, if the
+// history of the tasks tells how long they take, and by the last line of
+// their output in grouped mode.
 
 func (r *Reporter) drawTasksLine() {
 	// Calculate blocked tasks
 	blockedSet := r.deps.blocked()
+	for id := range r.waiting {
+		blockedSet[id] = true
+	}
 
 	var blocked []int
 	for id := range blockedSet {
@@ -64,18 +86,59 @@ func (r *Reporter) drawTasksLine() {
 	}
 	sort.Ints(running)
 
+	r.updateComputed(blockedSet)
+	names := map[int]string{}
+	for _, id := range running {
+		names[id] = r.unfinished[id] + r.timeLeft(id)
+		if line := r.lastLines[id]; line != "" {
+			names[id] += ": " + line
+		}
+	}
+
 	// Keep the last column of the terminal free, or the cursor
 	// will jump to the next line and won't be clearable until
 	// this code learns to use cursor navigation commands.
 	maxSize := r.termCols - 1
 
-	runningStr := formatRunningTasks(maxSize, running, r.unfinished)
+	runningStr := formatRunningTasks(maxSize, running, names)
 	blockedStr := formatBlockedTasks(maxSize-len(runningStr), blocked)
 
 	// Clear the existing tasks line, draw it, move cursor back
 	fmt.Printf("%s%s%s%s%s%s\r", clearToEndOfLine, gray, blockedStr, blue, runningStr, defColor)
 }
 
+// updateComputed accounts the time the tasks have been computing since the
+// last update, given the tasks blocked now
+func (r *Reporter) updateComputed(blocked map[int]bool) {
+	now := time.Now()
+	for id := range r.unfinished {
+		if since, ok := r.computing[id]; ok {
+			r.computed[id] += now.Sub(since)
+			delete(r.computing, id)
+		}
+		if !blocked[id] {
+			r.computing[id] = now
+		}
+	}
+}
+
+// timeLeft formats the estimated time left for the task to compute, or returns
+// an empty string if there is no estimate or the task has already taken longer
+func (r *Reporter) timeLeft(id int) string {
+	estimate, ok := r.estimates[id]
+	if !ok {
+		return ""
+	}
+	left := estimate - r.computed[id]
+	if since, ok := r.computing[id]; ok {
+		left -= time.Since(since)
+	}
+	if left < time.Second {
+		return ""
+	}
+	return fmt.Sprintf(" (~%s left)", left.Round(time.Second))
+}
+
 func formatRunningTasks(maxSize int, running []int, allTasks map[int]string) string {
 	// Deal with awkward conditions first to avoid doing extra checks below
 	if len(running) == 0 {
@@ -150,6 +213,11 @@ func (r *Reporter) Started(t *task.Task) {
 	defer r.mu.Unlock()
 
 	r.unfinished[t.ID] = t.ShortName()
+	if r.history != nil {
+		if median, runs := r.history.Median(t.Name()); runs > 0 {
+			r.estimates[t.ID] = median
+		}
+	}
 
 	r.drawTasksLine()
 }
@@ -165,12 +233,49 @@ func (r *Reporter) Dependencies(dependent *task.Task, dependees []*task.Task, se
 	r.drawTasksLine()
 }
 
+func (r *Reporter) PoolWaiting(t *task.Task, pool *task.Pool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.waiting[t.ID] = true
+
+	r.drawTasksLine()
+}
+
+func (r *Reporter) PoolAcquired(t *task.Task, pool *task.Pool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.waiting, t.ID)
+
+	r.drawTasksLine()
+}
+
+func (r *Reporter) Retrying(t *task.Task, attempt int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.unfinished[t.ID] = fmt.Sprintf("%s (attempt %d)", t.ShortName(), attempt)
+
+	r.drawTasksLine()
+}
+
 func (r *Reporter) Finished(t *task.Task) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.grouped {
+		r.printOutput(os.Stdout, t)
+	}
+
 	r.deps.unblock(t.ID)
 	delete(r.unfinished, t.ID)
+	delete(r.waiting, t.ID)
+	delete(r.estimates, t.ID)
+	delete(r.computed, t.ID)
+	delete(r.computing, t.ID)
+	delete(r.output, t.ID)
+	delete(r.lastLines, t.ID)
 
 	if t.ID == 0 && t.Error == nil {
 		// Last task finished successfully
@@ -187,10 +292,48 @@ func formatLine(line task.LogLine) string {
 	return line.Line
 }
 
+// printOutput prints the output of the finished task as a block, headed by
+// the name, the duration and the status of the task. Nothing is printed for
+// tasks that have succeeded without output.
+func (r *Reporter) printOutput(w io.Writer, t *task.Task) {
+	output := r.output[t.ID]
+	if len(output) == 0 && t.Error == nil {
+		return
+	}
+
+	color := lightGreen
+	if t.Error != nil {
+		color = red
+	}
+	fmt.Fprint(w, clearToEndOfLine)
+	fmt.Fprintf(w, "%s==> %s (%.02fs, %s)%s\n", color, t, t.Duration().Seconds(), t.Status(), defColor)
+	for _, line := range output {
+		fmt.Fprint(w, formatLine(line))
+	}
+}
+
+// lastLine trims the line of output to be shown in the tasks line
+func lastLine(line string) string {
+	line = strings.TrimSpace(strings.ReplaceAll(line, "\t", " "))
+	if runes := []rune(line); len(runes) > maxLastLineLen {
+		line = string(runes[:maxLastLineLen-3]) + "..."
+	}
+	return line
+}
+
 func (r *Reporter) OutputLine(t *task.Task, time time.Time, line task.LogLine) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
+	if r.grouped {
+		r.output[t.ID] = append(r.output[t.ID], line)
+		if s := lastLine(line.Line); s != "" {
+			r.lastLines[t.ID] = s
+		}
+		r.drawTasksLine()
+		return
+	}
+
 	// Clear the tasks line before drawing the output
 	fmt.Print(clearToEndOfLine)
 	fmt.Printf("%s %s", t.StringID(), formatLine(line))
@@ -198,6 +341,18 @@ func (r *Reporter) OutputLine(t *task.Task, time time.Time, line task.LogLine) {
 	r.drawTasksLine()
 }
 
+// redrawTimeLeft redraws the tasks line every second to keep the estimates of
+// the time left up to date
+func (r *Reporter) redrawTimeLeft() {
+	for range time.Tick(time.Second) {
+		r.mu.Lock()
+		if len(r.estimates) > 0 {
+			r.drawTasksLine()
+		}
+		r.mu.Unlock()
+	}
+}
+
 func (r *Reporter) handleTermWidthChange() {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -215,7 +370,11 @@ func termWidth() (int, error) {
 	return int(ws.Col), nil
 }
 
-func NewReporter() (*Reporter, error) {
+// NewReporter returns a reporter drawing the status of the tasks on the
+// terminal. Estimates of the time left for the tasks are taken from the
+// history, unless it is nil. In grouped mode output of each task is printed as
+// a block once the task finishes, instead of line by line as it comes.
+func NewReporter(history *task.History, grouped bool) (*Reporter, error) {
 	winszCh := make(chan os.Signal, 1)
 	// signal.Notify before TIOCGWINSZ to avoid missing a resize on startup
 	signal.Notify(winszCh, syscall.SIGWINCH)
@@ -228,11 +387,22 @@ func NewReporter() (*Reporter, error) {
 	r := &Reporter{
 		termCols:   cols,
 		unfinished: map[int]string{},
+		waiting:    map[int]bool{},
+		history:    history,
+		estimates:  map[int]time.Duration{},
+		computed:   map[int]time.Duration{},
+		computing:  map[int]time.Time{},
+		grouped:    grouped,
+		output:     map[int][]task.LogLine{},
+		lastLines:  map[int]string{},
 	}
 	go func() {
 		for range winszCh {
 			r.handleTermWidthChange()
 		}
 	}()
+	if history != nil {
+		go r.redrawTimeLeft()
+	}
 	return r, nil
 }
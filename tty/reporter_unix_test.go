@@ -0,0 +1,102 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+
+package tty
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ridge/game/task"
+)
+
+type named string
+
+func (n named) Run(ctx task.Context) {}
+
+func (n named) String() string {
+	return string(n)
+}
+
+func finishedTask(id int, name string, err error) *task.Task {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	return &task.Task{
+		ID:       id,
+		Runnable: named(name),
+		Spans:    []task.Span{{Start: start, End: start.Add(1500 * time.Millisecond), Attempt: 1}},
+		Error:    err,
+	}
+}
+
+func TestPrintOutput(t *testing.T) {
+	cancelled := finishedTask(4, "Cancelled", context.Canceled)
+	cancelled.Cancelled = true
+	timedOut := finishedTask(5, "Download", task.TimeoutError{Timeout: time.Second, Err: context.DeadlineExceeded})
+	upToDate := finishedTask(6, "Generate", nil)
+	upToDate.UpToDate = true
+
+	for _, tc := range []struct {
+		task     *task.Task
+		output   []task.LogLine
+		expected string
+	}{
+		{
+			task: finishedTask(1, "Build", nil),
+			output: []task.LogLine{
+				{Stream: task.StdoutStream, Line: "compiling\n"},
+				{Stream: task.StderrStream, Line: "warning\n"},
+			},
+			expected: clearToEndOfLine + lightGreen + "==> #0001 Build (1.50s, succeeded)" + defColor + "\n" +
+				"compiling\n" + red + "warning" + defColor + "\n",
+		},
+		{
+			task:     finishedTask(2, "Quiet", nil),
+			expected: "",
+		},
+		{
+			task:     finishedTask(3, "Broken", errors.New("broken")),
+			expected: clearToEndOfLine + red + "==> #0003 Broken (1.50s, failed)" + defColor + "\n",
+		},
+		{
+			task:     cancelled,
+			output:   []task.LogLine{{Stream: task.StdoutStream, Line: "started\n"}},
+			expected: clearToEndOfLine + red + "==> #0004 Cancelled (1.50s, cancelled)" + defColor + "\n" + "started\n",
+		},
+		{
+			task:     timedOut,
+			expected: clearToEndOfLine + red + "==> #0005 Download (1.50s, timedout)" + defColor + "\n",
+		},
+		{
+			task:     upToDate,
+			output:   []task.LogLine{{Stream: task.StdoutStream, Line: "up to date\n"}},
+			expected: clearToEndOfLine + lightGreen + "==> #0006 Generate (1.50s, skipped)" + defColor + "\n" + "up to date\n",
+		},
+	} {
+		r := &Reporter{output: map[int][]task.LogLine{tc.task.ID: tc.output}}
+		out := &bytes.Buffer{}
+		r.printOutput(out, tc.task)
+		if actual := out.String(); actual != tc.expected {
+			t.Errorf("%s: expected %q, but got %q", tc.task.Name(), tc.expected, actual)
+		}
+	}
+}
+
+func TestLastLine(t *testing.T) {
+	for _, tc := range []struct {
+		line     string
+		expected string
+	}{
+		{line: "compiling\n", expected: "compiling"},
+		{line: "  \n", expected: ""},
+		{line: "\tok\tpackage\n", expected: "ok package"},
+		{line: "0123456789012345678901234567890123456789\n", expected: "0123456789012345678901234567890123456789"},
+		{line: "0123456789012345678901234567890123456789x\n", expected: "0123456789012345678901234567890123456..."},
+		{line: "ёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёё", expected: "ёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёёё..."},
+	} {
+		if actual := lastLine(tc.line); actual != tc.expected {
+			t.Errorf("%q: expected %q, but got %q", tc.line, tc.expected, actual)
+		}
+	}
+}